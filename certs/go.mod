@@ -4,12 +4,15 @@ go 1.22.5
 
 require (
 	copr-pulumi-go-aws v0.0.0-00010101000000-000000000000
+	copr-pulumi-go-aws-outputs v0.0.0-00010101000000-000000000000
 	github.com/pulumi/pulumi-aws/sdk/v6 v6.48.0
 	github.com/pulumi/pulumi/sdk/v3 v3.130.0
 )
 
 replace copr-pulumi-go-aws => ../cluster
 
+replace copr-pulumi-go-aws-outputs => ../outputs
+
 require (
 	dario.cat/mergo v1.0.0 // indirect
 	github.com/BurntSushi/toml v1.2.1 // indirect
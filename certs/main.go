@@ -2,11 +2,22 @@ package main
 
 import (
 	"copr-pulumi-go-aws-certs/resources"
+	"copr-pulumi-go-aws-outputs"
 
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/acm"
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi/config"
 )
 
+// stackOutputs returns the outputs the cluster stack reads from the certs stack.
+func stackOutputs(cert *acm.Certificate) pulumi.Map {
+	return pulumi.Map{
+		outputs.ALBCertARN:                     cert.Arn,
+		outputs.ALBCertDomainName:              cert.DomainName,
+		outputs.ALBCertSubjectAlternativeNames: cert.SubjectAlternativeNames,
+	}
+}
+
 func main() {
 	pulumi.Run(func(ctx *pulumi.Context) error {
 		// Fetch configuration values
@@ -17,9 +28,9 @@ func main() {
 			return err
 		}
 
-		ctx.Export("ALBCertARN", cert.Arn)
-		ctx.Export("ALBCertDomainName", cert.DomainName)
-		ctx.Export("ALBCertSubjectAlternativeNames", cert.SubjectAlternativeNames)
+		for name, value := range stackOutputs(cert) {
+			ctx.Export(name, value)
+		}
 		return nil
 	})
 }
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"sort"
+	"testing"
+
+	"copr-pulumi-go-aws-outputs"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/acm"
+)
+
+func TestStackOutputsContract(t *testing.T) {
+	var exported []string
+	for key := range stackOutputs(&acm.Certificate{}) {
+		exported = append(exported, key)
+	}
+	contract := outputs.Keys(outputs.Certs{})
+	sort.Strings(exported)
+	sort.Strings(contract)
+	if len(exported) != len(contract) {
+		t.Fatalf("exported %v, want the outputs contract %v", exported, contract)
+	}
+	for i := range exported {
+		if exported[i] != contract[i] {
+			t.Fatalf("exported %v, want the outputs contract %v", exported, contract)
+		}
+	}
+}
@@ -19,7 +19,14 @@ func CreateCert(
 ) (*acm.Certificate, error) {
 	resourcePrefix := cfg.Require("resourcePrefix")
 	domainName := cfg.Require("albDomainName")
-	zoneId, err := clusterResources.GetPublicHostedZoneID(ctx, cfg.Require("vpcProjectName"))
+	vpcStack, err := clusterResources.VPCStackRef(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	zoneId, err := clusterResources.GetPublicHostedZoneID(ctx, vpcStack)
+	if err != nil {
+		return nil, err
+	}
 
 	cert, err := acm.NewCertificate(ctx, resourcePrefix+name, &acm.CertificateArgs{
 		DomainName:              pulumi.String(domainName),
@@ -60,6 +67,9 @@ func CreateCert(
 		CertificateArn:        cert.Arn,
 		ValidationRecordFqdns: validationNames,
 	})
+	if err != nil {
+		return nil, err
+	}
 
 	ctx.Export("certArn"+name, cert.Arn)
 	ctx.Export("certDomainName"+name, cert.DomainName)
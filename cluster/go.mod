@@ -3,6 +3,7 @@ module copr-pulumi-go-aws
 go 1.22.5
 
 require (
+	copr-pulumi-go-aws-outputs v0.0.0-00010101000000-000000000000
 	github.com/pulumi/pulumi-aws/sdk/v6 v6.48.0
 	github.com/pulumi/pulumi/sdk/v3 v3.127.0
 )
@@ -92,3 +93,5 @@ require (
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 	lukechampine.com/frand v1.4.2 // indirect
 )
+
+replace copr-pulumi-go-aws-outputs => ../outputs
@@ -21,11 +21,26 @@ func CreateALB(
 	// Fetch configuration values
 	resourcePrefix := cfg.Require("resourcePrefix")
 
-	fqdns, _ := GetALBCertSubjectAlternativeNames(ctx, cfg.Require("certsProjectName"))
+	vpcStack, err := VPCStackRef(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	certsStack, err := CertsStackRef(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
 
-	vpcid, err := GetVPCID(ctx, cfg.Require("vpcProjectName"))
+	fqdns, err := GetALBCertSubjectAlternativeNames(ctx, certsStack)
+	if err != nil {
+		return nil, err
+	}
+
+	vpcid, err := GetVPCID(ctx, vpcStack)
+	if err != nil {
+		return nil, err
+	}
 
-	subnets, err := GetSubnets(ctx, cfg.Require("vpcProjectName"), public)
+	subnets, err := GetSubnets(ctx, vpcStack, public)
 	if err != nil {
 		return nil, err
 	}
@@ -44,7 +59,10 @@ func CreateALB(
 		return nil, err
 	}
 
-	zoneId, _ := GetPublicHostedZoneID(ctx, cfg.Require("vpcProjectName"))
+	zoneId, err := GetPublicHostedZoneID(ctx, vpcStack)
+	if err != nil {
+		return nil, err
+	}
 
 	r53Names := fqdns.ApplyT(func(values []string) ([]string, error) {
 		_r53Names := []string{}
@@ -92,8 +110,13 @@ func CreateALB(
 		return nil, err
 	}
 
-	for _, instance := range listenerInstances {
-		_, err = alb.NewTargetGroupAttachment(ctx, resourcePrefix+name+"-frontend-tga", &alb.TargetGroupAttachmentArgs{
+	for i, instance := range listenerInstances {
+		// The first attachment keeps the name it had when there could only be one
+		tgaName := resourcePrefix + name + "-frontend-tga"
+		if i > 0 {
+			tgaName = fmt.Sprintf("%s-%d", tgaName, i+1)
+		}
+		_, err = alb.NewTargetGroupAttachment(ctx, tgaName, &alb.TargetGroupAttachmentArgs{
 			TargetGroupArn: targetGroup.Arn,
 			TargetId:       instance.ID(),
 			Port:           pulumi.Int(5000),
@@ -119,8 +142,15 @@ func CreateALB(
 		},
 	})
 
+	if err != nil {
+		return nil, err
+	}
+
 	// Get the ALB Cert ARN
-	certArn, err := GetALBCertARN(ctx, cfg.Require("certsProjectName"))
+	certArn, err := GetALBCertARN(ctx, certsStack)
+	if err != nil {
+		return nil, err
+	}
 
 	_, err = alb.NewListener(ctx, resourcePrefix+name+"-https-forward-listener", &alb.ListenerArgs{
 		LoadBalancerArn: loadBalancer.Arn,
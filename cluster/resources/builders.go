@@ -0,0 +1,284 @@
+package resources
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/autoscaling"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ec2"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/iam"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi/config"
+)
+
+// Instance types of builders that do not set instanceType, by architecture
+var defaultBuilderInstanceTypes = map[string]string{
+	ArchX86_64: "c7i.xlarge",
+	ArchArm64:  "c7g.xlarge",
+}
+
+// BuilderArgs is one entry of the builders config map, keyed by the builders' architecture, x86_64 or arm64.
+type BuilderArgs struct {
+	InstanceType string `json:"instanceType"`
+	// RootVolumeSize is in GiB
+	RootVolumeSize int `json:"rootVolumeSize"`
+	// Image selects the builders' AMI, its Arch is the key of the entry
+	Image ImageArgs `json:"image"`
+	// SubnetTier is public or private, public by default. Private builders need the VPC to have NAT.
+	SubnetTier string `json:"subnetTier"`
+	// The Auto Scaling group is only created with a MaxSize. Without one, resalloc starts the builders itself from the
+	// launch template.
+	MinSize int `json:"minSize"`
+	MaxSize int `json:"maxSize"`
+}
+
+// getBuilders reads the builders config map.
+func getBuilders(cfg *config.Config) (map[string]BuilderArgs, error) {
+	var builders map[string]BuilderArgs
+	if err := cfg.GetObject("builders", &builders); err != nil {
+		return nil, err
+	}
+
+	for arch, builder := range builders {
+		defaultType, ok := defaultBuilderInstanceTypes[arch]
+		if !ok {
+			return nil, fmt.Errorf("builders: unknown architecture %q, want %s or %s", arch, ArchX86_64, ArchArm64)
+		}
+		if builder.InstanceType == "" {
+			builder.InstanceType = defaultType
+		}
+		if builder.RootVolumeSize == 0 {
+			builder.RootVolumeSize = defaultRootVolumeSize
+		}
+		if builder.SubnetTier == "" {
+			builder.SubnetTier = SubnetTierPublic
+		}
+		if builder.SubnetTier != SubnetTierPublic && builder.SubnetTier != SubnetTierPrivate {
+			return nil, fmt.Errorf("builders %s: unknown subnetTier %q, want %s or %s",
+				arch, builder.SubnetTier, SubnetTierPublic, SubnetTierPrivate)
+		}
+		if builder.MinSize < 0 || builder.MinSize > builder.MaxSize {
+			return nil, fmt.Errorf("builders %s: minSize %d does not fit maxSize %d", arch, builder.MinSize, builder.MaxSize)
+		}
+		if builder.Image.Arch != "" && builder.Image.Arch != arch {
+			return nil, fmt.Errorf("builders %s: the image is for %s", arch, builder.Image.Arch)
+		}
+		builder.Image.Arch = arch
+		builders[arch] = builder
+	}
+	return builders, nil
+}
+
+// createBuilderInstanceProfile creates the instance profile of the builders. It only grants Systems Manager access,
+// so that the builders can be reached without SSH when something goes wrong.
+func createBuilderInstanceProfile(ctx *pulumi.Context, resourcePrefix string) (*iam.InstanceProfile, error) {
+	assumeRolePolicy, err := json.Marshal(map[string]interface{}{
+		"Version": "2012-10-17",
+		"Statement": []map[string]interface{}{
+			{
+				"Effect":    "Allow",
+				"Principal": map[string]string{"Service": "ec2.amazonaws.com"},
+				"Action":    "sts:AssumeRole",
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := iam.NewRole(ctx, resourcePrefix+"builder-role", &iam.RoleArgs{
+		Name:             pulumi.String(resourcePrefix + "builder-role"),
+		AssumeRolePolicy: pulumi.String(string(assumeRolePolicy)),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(resourcePrefix + "builder-role"),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = iam.NewRolePolicyAttachment(ctx, resourcePrefix+"builder-role-ssm", &iam.RolePolicyAttachmentArgs{
+		Role:      role.Name,
+		PolicyArn: pulumi.String("arn:aws:iam::aws:policy/AmazonSSMManagedInstanceCore"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return iam.NewInstanceProfile(ctx, resourcePrefix+"builder-profile", &iam.InstanceProfileArgs{
+		Name: pulumi.String(resourcePrefix + "builder-profile"),
+		Role: role.Name,
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(resourcePrefix + "builder-profile"),
+		},
+	})
+}
+
+// builderUserData lets the admins in alongside the backend, whose key pair the launch template sets.
+func builderUserData(adminKeys []string) (string, error) {
+	userData := "#cloud-config\n"
+	if len(adminKeys) > 0 {
+		userData += "ssh_authorized_keys:\n  - " + strings.Join(adminKeys, "\n  - ") + "\n"
+	}
+	if strings.Contains(userData, "\t") {
+		return "", fmt.Errorf("user data contains tabs")
+	}
+	return base64.StdEncoding.EncodeToString([]byte(userData)), nil
+}
+
+// CreateBuilders creates the infrastructure of the COPR builders in the builders config map: a launch template per
+// architecture, the builders' instance profile and, for the architectures with a maxSize, an Auto Scaling group.
+// The launch template IDs, subnets and security groups are exported for the resalloc pools of copr-backend. Nothing
+// is created without builders.
+func CreateBuilders(ctx *pulumi.Context, cfg *config.Config, sGroups *SecurityGroups, pins *ImagePins) error {
+	resourcePrefix := cfg.Require("resourcePrefix")
+	debug := cfg.RequireBool("debug")
+
+	builders, err := getBuilders(cfg)
+	if err != nil {
+		return err
+	}
+	if len(builders) == 0 {
+		return nil
+	}
+
+	vpcStack, err := VPCStackRef(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	sshKey, err := SetupSSHKey(ctx, resourcePrefix+"keypair", cfg.Require("sshKeySSMPathBase"))
+	if err != nil {
+		return err
+	}
+
+	profile, err := createBuilderInstanceProfile(ctx, resourcePrefix)
+	if err != nil {
+		return err
+	}
+
+	userData, err := builderUserData(getAdminSSHKeys(cfg))
+	if err != nil {
+		return err
+	}
+
+	defaultTags := getDefaultTags(cfg)
+
+	// Create the builders in a stable order
+	archs := make([]string, 0, len(builders))
+	for arch := range builders {
+		archs = append(archs, arch)
+	}
+	sort.Strings(archs)
+
+	launchTemplateIDs := pulumi.StringMap{}
+	autoScalingGroups := pulumi.StringMap{}
+	subnetIDs := pulumi.StringArrayMap{}
+	for _, arch := range archs {
+		builder := builders[arch]
+		name := resourcePrefix + "builder-" + arch
+
+		// Builders have always been pinned, there is no instance of theirs to keep
+		image, err := pins.Resolve(ctx, "builder-"+arch, builder.Image, "")
+		if err != nil {
+			return err
+		}
+
+		subnets, err := GetSubnets(ctx, vpcStack, builder.SubnetTier == SubnetTierPublic)
+		if err != nil {
+			return err
+		}
+
+		tags := pulumi.StringMap{}
+		for k, v := range defaultTags {
+			tags[k] = pulumi.String(v)
+		}
+		tags["Name"] = pulumi.String(name)
+		tags["ansible-ssh-user"] = pulumi.String(image.LoginUser)
+
+		launchTemplate, err := ec2.NewLaunchTemplate(ctx, name, &ec2.LaunchTemplateArgs{
+			Name:         pulumi.String(name),
+			ImageId:      pulumi.String(image.ID),
+			InstanceType: pulumi.String(builder.InstanceType),
+			KeyName:      sshKey.KeyName,
+			UserData:     pulumi.String(userData),
+			IamInstanceProfile: &ec2.LaunchTemplateIamInstanceProfileArgs{
+				Arn: profile.Arn,
+			},
+			NetworkInterfaces: ec2.LaunchTemplateNetworkInterfaceArray{
+				&ec2.LaunchTemplateNetworkInterfaceArgs{
+					AssociatePublicIpAddress: pulumi.String(fmt.Sprint(builder.SubnetTier == SubnetTierPublic)),
+					SecurityGroups:           pulumi.StringArray{sGroups.Builder.ID()},
+					DeleteOnTermination:      pulumi.String("true"),
+				},
+			},
+			BlockDeviceMappings: ec2.LaunchTemplateBlockDeviceMappingArray{
+				&ec2.LaunchTemplateBlockDeviceMappingArgs{
+					DeviceName: pulumi.String("/dev/sda1"),
+					Ebs: &ec2.LaunchTemplateBlockDeviceMappingEbsArgs{
+						VolumeSize:          pulumi.Int(builder.RootVolumeSize),
+						VolumeType:          pulumi.String("gp3"),
+						DeleteOnTermination: pulumi.String("true"),
+					},
+				},
+			},
+			// Builders are thrown away after every build, they need not be kept from termination
+			DisableApiTermination: pulumi.Bool(false),
+			TagSpecifications: ec2.LaunchTemplateTagSpecificationArray{
+				&ec2.LaunchTemplateTagSpecificationArgs{
+					ResourceType: pulumi.String("instance"),
+					Tags:         tags,
+				},
+				&ec2.LaunchTemplateTagSpecificationArgs{
+					ResourceType: pulumi.String("volume"),
+					Tags:         tags,
+				},
+			},
+			UpdateDefaultVersion: pulumi.Bool(true),
+			Tags: pulumi.StringMap{
+				"Name": pulumi.String(name),
+			},
+		})
+		if err != nil {
+			return err
+		}
+		launchTemplateIDs[arch] = launchTemplate.ID().ToStringOutput()
+		subnetIDs[arch] = subnets
+
+		if builder.MaxSize == 0 {
+			continue
+		}
+		group, err := autoscaling.NewGroup(ctx, name, &autoscaling.GroupArgs{
+			Name:               pulumi.String(name),
+			MinSize:            pulumi.Int(builder.MinSize),
+			MaxSize:            pulumi.Int(builder.MaxSize),
+			VpcZoneIdentifiers: subnets,
+			LaunchTemplate: &autoscaling.GroupLaunchTemplateArgs{
+				Id:      launchTemplate.ID(),
+				Version: pulumi.Sprintf("%d", launchTemplate.LatestVersion),
+			},
+			ForceDelete: pulumi.Bool(debug),
+			Tags: autoscaling.GroupTagArray{
+				&autoscaling.GroupTagArgs{
+					Key:               pulumi.String("Name"),
+					Value:             pulumi.String(name),
+					PropagateAtLaunch: pulumi.Bool(false),
+				},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		autoScalingGroups[arch] = group.Name
+	}
+
+	ctx.Export("builderLaunchTemplateIds", launchTemplateIDs)
+	ctx.Export("builderSubnetIds", subnetIDs)
+	ctx.Export("builderSecurityGroupIds", pulumi.StringArray{sGroups.Builder.ID()})
+	ctx.Export("builderInstanceProfileArn", profile.Arn)
+	ctx.Export("builderAutoScalingGroups", autoScalingGroups)
+	return nil
+}
@@ -0,0 +1,104 @@
+package resources
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ec2"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi/config"
+)
+
+// builderMocks serves the VPC stack like stackMocks, and AMIs and SSM parameters like amiMocks.
+type builderMocks struct {
+	*amiMocks
+}
+
+func (m builderMocks) NewResource(args pulumi.MockResourceArgs) (string, resource.PropertyMap, error) {
+	if args.TypeToken == "pulumi:pulumi:StackReference" {
+		return stackMocks{}.NewResource(args)
+	}
+	return m.amiMocks.NewResource(args)
+}
+
+func (m builderMocks) Call(args pulumi.MockCallArgs) (resource.PropertyMap, error) {
+	if args.Token == "aws:ssm/getParameter:getParameter" {
+		return resource.PropertyMap{"value": resource.NewStringProperty("ssh-ed25519 AAAA backend")}, nil
+	}
+	return m.amiMocks.Call(args)
+}
+
+func TestCreateBuilders(t *testing.T) {
+	t.Setenv(pulumi.EnvConfig, `{
+		"copr-pulumi-go-aws:resourcePrefix": "copr-test-",
+		"copr-pulumi-go-aws:debug": "true",
+		"copr-pulumi-go-aws:sshKeySSMPathBase": "/copr-test/ssh",
+		"copr-pulumi-go-aws:sshAdminKeys": "[\"ssh-ed25519 AAAA admin\"]",
+		"copr-pulumi-go-aws:defaultTags": "{\"app\": \"copr\"}",
+		"copr-pulumi-go-aws:vpcStackRef": "copr/vpc/test",
+		"copr-pulumi-go-aws:builders": "{\"x86_64\": {}, \"arm64\": {\"subnetTier\": \"private\", \"minSize\": 1, \"maxSize\": 4}}"
+	}`)
+	m := builderMocks{&amiMocks{}}
+	err := pulumi.RunErr(func(ctx *pulumi.Context) error {
+		cfg := config.New(ctx, "copr-pulumi-go-aws")
+		builder, err := ec2.NewSecurityGroup(ctx, "copr-test-builder-sg", &ec2.SecurityGroupArgs{})
+		if err != nil {
+			return err
+		}
+		pins, err := LoadImagePins(ctx, cfg)
+		if err != nil {
+			return err
+		}
+		return CreateBuilders(ctx, cfg, &SecurityGroups{Builder: builder}, pins)
+	}, pulumi.WithMocks("copr-pulumi-go-aws", "test", m))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created := map[string]int{}
+	for _, name := range m.resources {
+		created[name]++
+	}
+	// A launch template for each architecture and an Auto Scaling group only for arm64, which has a maxSize
+	for name, want := range map[string]int{
+		"copr-test-builder-arm64":   2,
+		"copr-test-builder-x86_64":  1,
+		"copr-test-builder-profile": 1,
+		"copr-test-builder-role":    1,
+	} {
+		if created[name] != want {
+			t.Errorf("created %d resources named %s, want %d", created[name], name, want)
+		}
+	}
+
+	archs := map[string]bool{}
+	for _, lookup := range m.lookups {
+		for _, filter := range lookup["filters"].ArrayValue() {
+			if filter.ObjectValue()["name"].StringValue() == "architecture" {
+				archs[filter.ObjectValue()["values"].ArrayValue()[0].StringValue()] = true
+			}
+		}
+	}
+	if !archs[ArchArm64] || !archs[ArchX86_64] {
+		t.Errorf("looked up images for %v, want both architectures", archs)
+	}
+}
+
+func TestBuilderArgs(t *testing.T) {
+	for builders, want := range map[string]string{
+		`{\"ppc64le\": {}}`:                                "unknown architecture",
+		`{\"arm64\": {\"minSize\": 2}}`:                    "does not fit maxSize",
+		`{\"arm64\": {\"image\": {\"arch\": \"x86_64\"}}}`: "the image is for x86_64",
+	} {
+		t.Setenv(pulumi.EnvConfig, `{"copr-pulumi-go-aws:builders": "`+builders+`"}`)
+		var err error
+		_ = pulumi.RunErr(func(ctx *pulumi.Context) error {
+			_, err = getBuilders(config.New(ctx, "copr-pulumi-go-aws"))
+			return err
+		}, pulumi.WithMocks("copr-pulumi-go-aws", "test", stackMocks{}))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("getBuilders(%s) error = %v, want %q", builders, err, want)
+		}
+	}
+}
@@ -11,10 +11,13 @@ import (
 func CreateDatabase(ctx *pulumi.Context, cfg *config.Config, dbsg *ec2.SecurityGroup) error {
 	resourcePrefix := cfg.Require("resourcePrefix")
 	instanceType := cfg.Require("instanceTypeDB")
-	vpcProject := cfg.Require("vpcProjectName")
 	debug := cfg.RequireBool("debug")
 
-	subnetID, err := GetFirstSubnet(ctx, vpcProject, false)
+	vpcStack, err := VPCStackRef(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	dbSubnetGroupName, err := GetDBSubnetGroupName(ctx, vpcStack)
 	if err != nil {
 		return err
 	}
@@ -37,7 +40,7 @@ func CreateDatabase(ctx *pulumi.Context, cfg *config.Config, dbsg *ec2.SecurityG
 		EngineVersion:       pulumi.String("15"),
 		Username:            pulumi.String("admin"),
 		Password:            ssmParameter.Value,
-		DbSubnetGroupName:   subnetID,
+		DbSubnetGroupName:   dbSubnetGroupName,
 		VpcSecurityGroupIds: pulumi.StringArray{dbsg.ID()},
 		MaxAllocatedStorage: pulumi.Int(20),
 		SkipFinalSnapshot:   pulumi.Bool(debug),
@@ -0,0 +1,230 @@
+package resources
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ec2"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ssm"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi/config"
+)
+
+// ImagePins keep each role on the AMI it was created with. Resolving an image always finds the latest one, which
+// would replace the role's instances whenever the distro publishes a new image, so the AMI of a role is pinned: in
+// the amiPins config map, which the stack's owner maintains, or else in an SSM parameter under amiPinsPath, which
+// the stack maintains itself and sets on the role's first deployment. Setting refreshImages moves the roles pinned
+// in SSM to their latest image.
+type ImagePins struct {
+	refresh bool
+	ssmPath string
+	// config are the pins of the amiPins config map, ssm those of the SSM parameters
+	config map[string]imagePin
+	ssm    map[string]imagePin
+
+	used    map[string]imagePin
+	updates map[string]string
+}
+
+// imagePin is a pinned AMI with the distro, version and architecture it was resolved for. Pins written before the
+// selector was stored, and pins of the config map given as a bare AMI ID, have none and stay with any selector.
+type imagePin struct {
+	Ami     string `json:"ami"`
+	Distro  string `json:"distro,omitempty"`
+	Version int    `json:"version,omitempty"`
+	Arch    string `json:"arch,omitempty"`
+}
+
+// UnmarshalJSON reads a pin object or a bare AMI ID.
+func (p *imagePin) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		*p = imagePin{}
+		return json.Unmarshal(data, &p.Ami)
+	}
+	type pin imagePin
+	return json.Unmarshal(data, (*pin)(p))
+}
+
+// selects reports whether the pin was resolved for the defaulted image selector. The pins of the config map may
+// leave out what is the default.
+func (p imagePin) selects(image ImageArgs) bool {
+	if p.Distro == "" {
+		return true
+	}
+	pinned, _, err := ImageArgs{Distro: p.Distro, Version: p.Version, Arch: p.Arch}.withDefaults()
+	return err == nil && pinned.Distro == image.Distro && pinned.Version == image.Version && pinned.Arch == image.Arch
+}
+
+func (p imagePin) String() string {
+	if p.Distro == "" {
+		return p.Ami
+	}
+	return fmt.Sprintf("%s (%s %d %s)", p.Ami, p.Distro, p.Version, p.Arch)
+}
+
+// LoadImagePins reads the pins of the stack.
+func LoadImagePins(ctx *pulumi.Context, cfg *config.Config) (*ImagePins, error) {
+	pins := &ImagePins{
+		refresh: cfg.GetBool("refreshImages"),
+		ssmPath: cfg.Get("amiPinsPath"),
+		ssm:     map[string]imagePin{},
+		used:    map[string]imagePin{},
+		updates: map[string]string{},
+	}
+	if pins.ssmPath == "" {
+		pins.ssmPath = "/ami-pins/" + strings.TrimSuffix(cfg.Require("resourcePrefix"), "-")
+	}
+	if err := cfg.GetObject("amiPins", &pins.config); err != nil {
+		return nil, err
+	}
+
+	// Unlike a lookup of a single parameter, this finds nothing rather than failing before the first pin
+	params, err := ssm.GetParametersByPath(ctx, &ssm.GetParametersByPathArgs{
+		Path: pins.ssmPath,
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	for i, name := range params.Names {
+		// The first pins were the bare AMI ID
+		pin := imagePin{Ami: params.Values[i]}
+		if strings.HasPrefix(params.Values[i], "{") {
+			if err := json.Unmarshal([]byte(params.Values[i]), &pin); err != nil {
+				return nil, fmt.Errorf("reading the image pin %s: %w", name, err)
+			}
+		}
+		pins.ssm[path.Base(name)] = pin
+	}
+	return pins, nil
+}
+
+// Resolve returns the image of role: its pinned AMI when it has one, unless refreshImages is set or the pin was
+// resolved for another distro, version or architecture than args selects. A newer image than the pinned one is
+// reported, and exported by Record, without being used. A role without a pin that already runs, as instance, is
+// pinned to the AMI of that instance rather than replaced; instance is the Name tag of the role's first instance, or
+// empty for a role without instances of its own.
+func (p *ImagePins) Resolve(ctx *pulumi.Context, role string, args ImageArgs, instance string) (*Image, error) {
+	latest, err := ResolveImage(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	// An explicit AMI needs no pinning
+	if args.Ami != "" {
+		return latest, nil
+	}
+	// ResolveImage has accepted the selector already
+	selector, _, err := args.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	current := imagePin{Ami: latest.ID, Distro: selector.Distro, Version: selector.Version, Arch: selector.Arch}
+
+	pinned, inConfig := p.config[role]
+	ok := inConfig
+	if !ok {
+		pinned, ok = p.ssm[role]
+	}
+	if inConfig && !pinned.selects(selector) {
+		return nil, fmt.Errorf("role %s selects %s %d %s, but amiPins.%s pins %s, update or remove the pin",
+			role, selector.Distro, selector.Version, selector.Arch, role, pinned)
+	}
+	if ok && !pinned.selects(selector) {
+		ctx.Log.Info("role "+role+" no longer selects the image of its pin "+pinned.String()+", moving it to "+
+			current.String(), nil)
+		ok = false
+	} else if !ok && instance != "" {
+		pinned.Ami, err = p.existingAmi(ctx, instance)
+		if err != nil {
+			return nil, err
+		}
+		if ok = pinned.Ami != ""; ok {
+			ctx.Log.Info("pinning role "+role+" to "+pinned.Ami+", the image instance "+instance+" runs", nil)
+		}
+	}
+
+	image, pin := latest, current
+	switch {
+	case !ok:
+		ctx.Log.Info("pinning role "+role+" to "+latest.ID, nil)
+	case pinned.Ami == latest.ID:
+	case p.refresh && !inConfig:
+		ctx.Log.Info("refreshing the image of role "+role+" from "+pinned.Ami+" to "+latest.ID, nil)
+	default:
+		// The preview shows this without touching the instances
+		move := "set refreshImages to move to it"
+		if inConfig {
+			move = "set amiPins." + role + " to move to it"
+		}
+		ctx.Log.Warn("role "+role+" is pinned to "+pinned.Ami+" but a newer image "+latest.ID+" is available, "+move, nil)
+		p.updates[role] = latest.ID
+		image = &Image{ID: pinned.Ami, LoginUser: latest.LoginUser}
+		pin.Ami = pinned.Ami
+	}
+
+	p.used[role] = pin
+	return image, nil
+}
+
+// existingAmi returns the AMI of the instance tagged Name, or an empty string when there is no such instance.
+func (p *ImagePins) existingAmi(ctx *pulumi.Context, name string) (string, error) {
+	instances, err := ec2.GetInstances(ctx, &ec2.GetInstancesArgs{
+		InstanceTags:       map[string]string{"Name": name},
+		InstanceStateNames: []string{"pending", "running", "stopping", "stopped"},
+	}, nil)
+	if err != nil {
+		return "", fmt.Errorf("looking up instance %s: %w", name, err)
+	}
+	if len(instances.Ids) == 0 {
+		return "", nil
+	}
+	instance, err := ec2.LookupInstance(ctx, &ec2.LookupInstanceArgs{
+		InstanceId: pulumi.StringRef(instances.Ids[0]),
+	}, nil)
+	if err != nil {
+		return "", fmt.Errorf("looking up instance %s: %w", name, err)
+	}
+	return instance.Ami, nil
+}
+
+// Record keeps the pins under amiPinsPath up to date and exports the AMI of every resolved role as imagePins and the
+// newer images that are available as imageUpdates.
+func (p *ImagePins) Record(ctx *pulumi.Context, cfg *config.Config) error {
+	resourcePrefix := cfg.Require("resourcePrefix")
+
+	roles := make([]string, 0, len(p.used))
+	for role := range p.used {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+
+	for _, role := range roles {
+		// Pins of the config map are the owner's to keep
+		if _, inConfig := p.config[role]; inConfig {
+			continue
+		}
+		value, err := json.Marshal(p.used[role])
+		if err != nil {
+			return err
+		}
+		_, err = ssm.NewParameter(ctx, resourcePrefix+"ami-pin-"+role, &ssm.ParameterArgs{
+			Name:        pulumi.String(path.Join(p.ssmPath, role)),
+			Type:        pulumi.String("String"),
+			Value:       pulumi.String(string(value)),
+			Description: pulumi.String("The AMI the " + role + " instances are pinned to"),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	amis := pulumi.StringMap{}
+	for role, pin := range p.used {
+		amis[role] = pulumi.String(pin.Ami)
+	}
+	ctx.Export("imagePins", amis)
+	ctx.Export("imageUpdates", pulumi.ToStringMap(p.updates))
+	return nil
+}
@@ -0,0 +1,143 @@
+package resources
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi/config"
+)
+
+func TestImagePins(t *testing.T) {
+	const latest = "ami-0125523088429"
+	pin := func(refresh, amiPins string, roles map[string]ImageArgs) (map[string]string, *ImagePins, *amiMocks, error) {
+		t.Helper()
+		t.Setenv(pulumi.EnvConfig, `{
+			"copr-pulumi-go-aws:resourcePrefix": "copr-test-",
+			"copr-pulumi-go-aws:refreshImages": "`+refresh+`",
+			"copr-pulumi-go-aws:amiPins": "`+amiPins+`"
+		}`)
+		m := &amiMocks{
+			params: map[string]string{
+				// A pin from before selectors were stored, and one for another distro than the role now selects
+				"/ami-pins/copr-test/backend": "ami-0old",
+				"/ami-pins/copr-test/distgit": `{"ami": "ami-0rocky", "distro": "rocky", "version": 9, "arch": "x86_64"}`,
+			},
+			instances: map[string]string{"copr-test-signer": "ami-0running"},
+		}
+		images := map[string]string{}
+		var pins *ImagePins
+		err := pulumi.RunErr(func(ctx *pulumi.Context) error {
+			cfg := config.New(ctx, "copr-pulumi-go-aws")
+			var err error
+			pins, err = LoadImagePins(ctx, cfg)
+			if err != nil {
+				return err
+			}
+			for role, args := range roles {
+				image, err := pins.Resolve(ctx, role, args, "copr-test-"+role)
+				if err != nil {
+					return err
+				}
+				images[role] = image.ID + " " + image.LoginUser
+			}
+			return pins.Record(ctx, cfg)
+		}, pulumi.WithMocks("copr-pulumi-go-aws", "test", m))
+		return images, pins, m, err
+	}
+	roles := map[string]ImageArgs{
+		"backend":  {},
+		"frontend": {},
+		"keygen":   {},
+		"signer":   {},
+		"distgit":  {},
+	}
+	const amiPins = `{\"keygen\": \"ami-0config\"}`
+
+	images, pins, m, err := pin("false", amiPins, roles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The backend stays on its pin, the frontend is pinned to the latest image, the config pin wins over SSM, the
+	// signer keeps the image its instance already runs, and distgit moves to the image of the distro it now selects
+	for role, want := range map[string]string{
+		"backend":  "ami-0old fedora",
+		"frontend": latest + " fedora",
+		"keygen":   "ami-0config fedora",
+		"signer":   "ami-0running fedora",
+		"distgit":  latest + " fedora",
+	} {
+		if images[role] != want {
+			t.Errorf("got image %s for role %s, want %s", images[role], role, want)
+		}
+	}
+	for role, want := range map[string]string{"backend": latest, "keygen": latest, "signer": latest} {
+		if pins.updates[role] != want {
+			t.Errorf("got image update %q for role %s, want %s", pins.updates[role], role, want)
+		}
+	}
+	if len(pins.updates) != 3 {
+		t.Errorf("got image updates %v, want the backend, keygen and signer ones", pins.updates)
+	}
+	sort.Strings(m.resources)
+	want := "copr-test-ami-pin-backend copr-test-ami-pin-distgit copr-test-ami-pin-frontend copr-test-ami-pin-signer"
+	if got := strings.Join(m.resources, " "); got != want {
+		t.Errorf("got resources %s, want SSM pins of the roles not pinned in config", got)
+	}
+	// Every pin is stored with the image it was resolved for
+	for role, want := range map[string]string{
+		"backend": `{"ami":"ami-0old","distro":"fedora","version":40,"arch":"x86_64"}`,
+		"distgit": `{"ami":"` + latest + `","distro":"fedora","version":40,"arch":"x86_64"}`,
+		"signer":  `{"ami":"ami-0running","distro":"fedora","version":40,"arch":"x86_64"}`,
+	} {
+		value := m.inputs["copr-test-ami-pin-"+role]["value"]
+		// The provider marks parameter values secret
+		if value.IsSecret() {
+			value = value.SecretValue().Element
+		}
+		if got := value.StringValue(); got != want {
+			t.Errorf("got pin %s for role %s, want %s", got, role, want)
+		}
+	}
+
+	images, pins, _, err = pin("true", amiPins, roles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if images["backend"] != latest+" fedora" || images["signer"] != latest+" fedora" ||
+		images["keygen"] != "ami-0config fedora" {
+		t.Errorf("got refreshed images %v, want the SSM pins refreshed and the config pin kept", images)
+	}
+	if pins.updates["backend"] != "" {
+		t.Errorf("got image updates %v after a refresh", pins.updates)
+	}
+
+	// The pin of a role holds as long as the role selects the image it was resolved for
+	for args, want := range map[ImageArgs]string{
+		{Distro: "rocky"}:                "ami-0rocky rocky",
+		{Distro: "rocky", Version: 9}:    "ami-0rocky rocky",
+		{Distro: "rocky", Version: 10}:   "ami-0792107900819 rocky",
+		{Distro: "rocky", Arch: "arm64"}: "ami-0792107900819 rocky",
+	} {
+		images, _, _, err = pin("false", amiPins, map[string]ImageArgs{"distgit": args})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if images["distgit"] != want {
+			t.Errorf("got image %s for a role that selects %+v, want %s", images["distgit"], args, want)
+		}
+	}
+
+	// A config pin for another image than the role selects is not the stack's to move, one for the same is kept
+	_, _, _, err = pin("false", `{\"keygen\": {\"ami\": \"ami-0config\", \"distro\": \"fedora\", \"version\": 39}}`,
+		map[string]ImageArgs{"keygen": {}})
+	if err == nil || !strings.Contains(err.Error(), "amiPins.keygen pins ami-0config (fedora 39 )") {
+		t.Errorf("Resolve() error = %v, want the outdated config pin", err)
+	}
+	images, _, _, err = pin("false", `{\"keygen\": {\"ami\": \"ami-0config\", \"distro\": \"fedora\", \"version\": 40}}`,
+		map[string]ImageArgs{"keygen": {Arch: ArchX86_64}})
+	if err != nil || images["keygen"] != "ami-0config fedora" {
+		t.Errorf("got image %s, error %v, want the config pin", images["keygen"], err)
+	}
+}
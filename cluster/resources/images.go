@@ -0,0 +1,161 @@
+package resources
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ec2"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// Architectures an image can be built for, as EC2 names them
+const (
+	ArchX86_64 = "x86_64"
+	ArchArm64  = "arm64"
+)
+
+// ImageArgs selects the AMI of a role: the latest image of Distro, Version and Arch, or Ami when it is set.
+type ImageArgs struct {
+	// Distro is one of ImageDistros, fedora by default
+	Distro string `json:"distro"`
+	// Version is the major version, the distro's current one by default
+	Version int `json:"version"`
+	// Arch is x86_64 or arm64, x86_64 by default
+	Arch string `json:"arch"`
+	Ami  string `json:"ami"`
+	// LoginUser overrides the distro's login user, for an Ami that is not a stock image
+	LoginUser string `json:"loginUser"`
+}
+
+// Image is a resolved AMI.
+type Image struct {
+	ID string
+	// LoginUser is the user cloud-init gives the instance's SSH key pair
+	LoginUser string
+}
+
+// ImageResolver finds the images of a distro.
+type ImageResolver interface {
+	// Resolve returns the ID of the latest image of the major version for arch, 0 meaning DefaultVersion
+	Resolve(ctx *pulumi.Context, version int, arch string) (string, error)
+	DefaultVersion() int
+	LoginUser() string
+}
+
+// amiFamily resolves the images a vendor publishes to EC2 under a name that includes the major version.
+type amiFamily struct {
+	owner string
+	// namePattern is the name filter with a %d for the major version
+	namePattern    string
+	defaultVersion int
+	loginUser      string
+}
+
+func (f amiFamily) Resolve(ctx *pulumi.Context, version int, arch string) (string, error) {
+	if version == 0 {
+		version = f.defaultVersion
+	}
+	ami, err := ec2.LookupAmi(ctx, &ec2.LookupAmiArgs{
+		MostRecent: pulumi.BoolRef(true),
+		Owners:     []string{f.owner},
+		Filters: []ec2.GetAmiFilter{
+			{
+				Name:   "name",
+				Values: []string{fmt.Sprintf(f.namePattern, version)},
+			},
+			{
+				Name:   "architecture",
+				Values: []string{arch},
+			},
+		},
+	}, nil)
+	if err != nil {
+		return "", err
+	}
+	return ami.Id, nil
+}
+
+func (f amiFamily) DefaultVersion() int {
+	return f.defaultVersion
+}
+
+func (f amiFamily) LoginUser() string {
+	return f.loginUser
+}
+
+// ImageDistros are the resolvers ImageArgs.Distro picks from
+var ImageDistros = map[string]ImageResolver{
+	"fedora": amiFamily{
+		owner:          "125523088429",
+		namePattern:    "Fedora-Cloud-Base-AmazonEC2.*-%d-*hvm-*-gp3-*",
+		defaultVersion: 40,
+		loginUser:      "fedora",
+	},
+	"rocky": amiFamily{
+		owner:          "792107900819",
+		namePattern:    "Rocky-%[1]d-EC2-LVM-%[1]d.*",
+		defaultVersion: 9,
+		loginUser:      "rocky",
+	},
+	"almalinux": amiFamily{
+		owner:          "764336703387",
+		namePattern:    "AlmaLinux OS %d.*",
+		defaultVersion: 9,
+		loginUser:      "ec2-user",
+	},
+	// CentOS publishes from the same account as Fedora
+	"centos-stream": amiFamily{
+		owner:          "125523088429",
+		namePattern:    "CentOS Stream %d *",
+		defaultVersion: 9,
+		loginUser:      "ec2-user",
+	},
+}
+
+// withDefaults returns image with the distro, version and architecture it selects spelled out, and the resolver of
+// its distro. Two ImageArgs that select the same images are equal once defaulted.
+func (image ImageArgs) withDefaults() (ImageArgs, ImageResolver, error) {
+	if image.Distro == "" {
+		image.Distro = "fedora"
+	}
+	resolver, ok := ImageDistros[image.Distro]
+	if !ok {
+		distros := make([]string, 0, len(ImageDistros))
+		for name := range ImageDistros {
+			distros = append(distros, name)
+		}
+		sort.Strings(distros)
+		return image, nil, fmt.Errorf("unknown image distro %q, want one of %v", image.Distro, distros)
+	}
+	if image.Version == 0 {
+		image.Version = resolver.DefaultVersion()
+	}
+	if image.Arch == "" {
+		image.Arch = ArchX86_64
+	}
+	if image.LoginUser == "" {
+		image.LoginUser = resolver.LoginUser()
+	}
+	return image, resolver, nil
+}
+
+// ResolveImage returns the AMI image selects, with the user to log in as.
+func ResolveImage(ctx *pulumi.Context, image ImageArgs) (*Image, error) {
+	image, resolver, err := image.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	if image.Ami != "" {
+		return &Image{ID: image.Ami, LoginUser: image.LoginUser}, nil
+	}
+
+	if image.Arch != ArchX86_64 && image.Arch != ArchArm64 {
+		return nil, fmt.Errorf("unknown image architecture %q, want %s or %s", image.Arch, ArchX86_64, ArchArm64)
+	}
+
+	id, err := resolver.Resolve(ctx, image.Version, image.Arch)
+	if err != nil {
+		return nil, err
+	}
+	return &Image{ID: id, LoginUser: image.LoginUser}, nil
+}
@@ -0,0 +1,127 @@
+package resources
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// amiMocks answers AMI lookups with ami-0<owner> and records their arguments. The SSM parameters by path are params,
+// and instances maps the Name tags of the running instances to their AMIs.
+type amiMocks struct {
+	mu        sync.Mutex
+	lookups   []resource.PropertyMap
+	params    map[string]string
+	instances map[string]string
+	resources []string
+	inputs    map[string]resource.PropertyMap
+}
+
+func (m *amiMocks) NewResource(args pulumi.MockResourceArgs) (string, resource.PropertyMap, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.resources = append(m.resources, args.Name)
+	if m.inputs == nil {
+		m.inputs = map[string]resource.PropertyMap{}
+	}
+	m.inputs[args.Name] = args.Inputs
+	return args.Name + "-id", args.Inputs, nil
+}
+
+func (m *amiMocks) Call(args pulumi.MockCallArgs) (resource.PropertyMap, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	outputs := args.Args.Copy()
+	switch args.Token {
+	case "aws:ec2/getAmi:getAmi":
+		m.lookups = append(m.lookups, args.Args)
+		outputs["id"] = resource.NewStringProperty("ami-0" + args.Args["owners"].ArrayValue()[0].StringValue())
+	case "aws:ssm/getParametersByPath:getParametersByPath":
+		var names, values []resource.PropertyValue
+		for name, value := range m.params {
+			names = append(names, resource.NewStringProperty(name))
+			values = append(values, resource.NewStringProperty(value))
+		}
+		outputs["names"] = resource.NewArrayProperty(names)
+		outputs["values"] = resource.NewArrayProperty(values)
+	case "aws:ec2/getInstances:getInstances":
+		var ids []resource.PropertyValue
+		if name := args.Args["instanceTags"].ObjectValue()["Name"].StringValue(); m.instances[name] != "" {
+			ids = append(ids, resource.NewStringProperty("i-0"+name))
+		}
+		outputs["ids"] = resource.NewArrayProperty(ids)
+	case "aws:ec2/getInstance:getInstance":
+		name := strings.TrimPrefix(args.Args["instanceId"].StringValue(), "i-0")
+		outputs["ami"] = resource.NewStringProperty(m.instances[name])
+	}
+	return outputs, nil
+}
+
+func resolveTestImage(t *testing.T, image ImageArgs) (*Image, *amiMocks, error) {
+	t.Helper()
+	m := &amiMocks{}
+	var resolved *Image
+	err := pulumi.RunErr(func(ctx *pulumi.Context) error {
+		var err error
+		resolved, err = ResolveImage(ctx, image)
+		return err
+	}, pulumi.WithMocks("copr-pulumi-go-aws", "test", m))
+	return resolved, m, err
+}
+
+func TestResolveImage(t *testing.T) {
+	tests := []struct {
+		image     ImageArgs
+		id        string
+		loginUser string
+		name      string
+		arch      string
+	}{
+		{ImageArgs{}, "ami-0125523088429", "fedora", "Fedora-Cloud-Base-AmazonEC2.*-40-*hvm-*-gp3-*", "x86_64"},
+		{ImageArgs{Distro: "rocky", Arch: ArchArm64}, "ami-0792107900819", "rocky", "Rocky-9-EC2-LVM-9.*", "arm64"},
+		{ImageArgs{Distro: "almalinux", Version: 10}, "ami-0764336703387", "ec2-user", "AlmaLinux OS 10.*", "x86_64"},
+		{ImageArgs{Distro: "centos-stream"}, "ami-0125523088429", "ec2-user", "CentOS Stream 9 *", "x86_64"},
+		{ImageArgs{Distro: "rocky", Ami: "ami-0pinned"}, "ami-0pinned", "rocky", "", ""},
+		{ImageArgs{Ami: "ami-0custom", LoginUser: "admin"}, "ami-0custom", "admin", "", ""},
+	}
+	for _, tt := range tests {
+		image, m, err := resolveTestImage(t, tt.image)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if image.ID != tt.id || image.LoginUser != tt.loginUser {
+			t.Errorf("ResolveImage(%+v) = %+v, want %s as %s", tt.image, image, tt.id, tt.loginUser)
+		}
+		if tt.name == "" {
+			if len(m.lookups) != 0 {
+				t.Errorf("ResolveImage(%+v) looked up an AMI although one is given", tt.image)
+			}
+			continue
+		}
+		if len(m.lookups) != 1 {
+			t.Fatalf("ResolveImage(%+v) made %d lookups, want 1", tt.image, len(m.lookups))
+		}
+		filters := map[string]string{}
+		for _, filter := range m.lookups[0]["filters"].ArrayValue() {
+			filters[filter.ObjectValue()["name"].StringValue()] = filter.ObjectValue()["values"].ArrayValue()[0].StringValue()
+		}
+		if filters["name"] != tt.name || filters["architecture"] != tt.arch {
+			t.Errorf("ResolveImage(%+v) filtered on %v, want %s for %s", tt.image, filters, tt.name, tt.arch)
+		}
+	}
+
+	for _, tt := range []struct {
+		image ImageArgs
+		err   string
+	}{
+		{ImageArgs{Distro: "debian"}, "unknown image distro"},
+		{ImageArgs{Arch: "ppc64le"}, "unknown image architecture"},
+	} {
+		if _, _, err := resolveTestImage(t, tt.image); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("ResolveImage(%+v) error = %v, want %q", tt.image, err, tt.err)
+		}
+	}
+}
@@ -69,6 +69,17 @@ func AttachSecurityGroups(
 	return nil
 }
 
+// spreadSubnet picks the subnet of the index'th instance of a role. The first instance stays in the first subnet,
+// where every instance used to go.
+func spreadSubnet(subnets pulumi.StringArrayOutput, index int) pulumi.StringOutput {
+	return subnets.ApplyT(func(ids []string) (string, error) {
+		if len(ids) == 0 {
+			return "", fmt.Errorf("the VPC stack has no subnets to place instances in")
+		}
+		return ids[index%len(ids)], nil
+	}).(pulumi.StringOutput)
+}
+
 func Route53Record(ctx *pulumi.Context, name string, zoneID, hostname, ip *pulumi.StringOutput, ttl int) (*route53.Record, error) {
 	return route53.NewRecord(ctx, name, &route53.RecordArgs{
 		Name:    hostname,
@@ -79,49 +90,57 @@ func Route53Record(ctx *pulumi.Context, name string, zoneID, hostname, ip *pulum
 	})
 }
 
+// CreateInstance creates the index'th instance of a role. The instances of a role take turns over the subnets of
+// its tier, so that a role with several instances spans several AZs.
 func CreateInstance(
 	ctx *pulumi.Context,
 	cfg *config.Config,
 	name string,
-	rootVolSize int,
+	index int,
+	role RoleArgs,
+	image *Image,
 	securityGroups []*ec2.SecurityGroup,
-	public bool,
 ) (*ec2.Instance, error) {
 	resourcePrefix := cfg.Require("resourcePrefix")
 	sshKeyPath := cfg.Require("sshKeySSMPathBase")
-	instanceType := cfg.Require("instanceTypeBackend")
-	vpcProject := cfg.Require("vpcProjectName")
+	public := role.SubnetTier == SubnetTierPublic
 	userSSHKeys := getAdminSSHKeys(cfg)
 
-	loginUser := "fedora"
-
-	subnetID, err := GetFirstSubnet(ctx, vpcProject, public)
+	vpcStack, err := VPCStackRef(ctx, cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	amiID, err := GetLatestFedoraAmi(ctx, 40)
+	subnets, err := GetSubnets(ctx, vpcStack, public)
 	if err != nil {
 		return nil, err
 	}
+	subnetID := spreadSubnet(subnets, index)
 
 	sshKey, err := SetupSSHKey(ctx, resourcePrefix+"keypair", sshKeyPath)
 	if err != nil {
 		return nil, err
 	}
 
-	extDomain, err := GetPublicDomainName(ctx, vpcProject)
+	extDomain, err := GetPublicDomainName(ctx, vpcStack)
 	if err != nil {
 		return nil, err
 	}
 
-	intDomain, err := GetPrivateDomainName(ctx, vpcProject)
+	intDomain, err := GetPrivateDomainName(ctx, vpcStack)
 	if err != nil {
 		return nil, err
 	}
 
-	intZoneID, err := GetPrivateHostedZoneID(ctx, vpcProject)
-	extZoneID, err := GetPublicHostedZoneID(ctx, vpcProject)
+	intZoneID, err := GetPrivateHostedZoneID(ctx, vpcStack)
+	if err != nil {
+		return nil, err
+	}
+
+	extZoneID, err := GetPublicHostedZoneID(ctx, vpcStack)
+	if err != nil {
+		return nil, err
+	}
 
 	subDomain := strings.TrimSuffix(resourcePrefix, "-")
 	subDomain = strings.ReplaceAll(subDomain, "-", ".")
@@ -173,7 +192,7 @@ users:
 	}
 
 	tags["Name"] = pulumi.String(resourcePrefix + name)
-	tags["ansible-ssh-user"] = pulumi.String(loginUser)
+	tags["ansible-ssh-user"] = pulumi.String(image.LoginUser)
 	tags["ansible-python-interpreter"] = pulumi.String("/usr/bin/python3")
 
 	ids := make(pulumi.StringArray, len(securityGroups))
@@ -183,8 +202,8 @@ users:
 
 	// Launch an EC2 instance with the resourcePrefix
 	inst, err := ec2.NewInstance(ctx, resourcePrefix+name, &ec2.InstanceArgs{
-		InstanceType:             pulumi.String(instanceType),
-		Ami:                      pulumi.String(amiID),
+		InstanceType:             pulumi.String(role.InstanceType),
+		Ami:                      pulumi.String(image.ID),
 		SubnetId:                 subnetID,
 		AssociatePublicIpAddress: pulumi.Bool(public),
 		DisableApiTermination:    pulumi.Bool(!debug),
@@ -196,7 +215,7 @@ users:
 		EbsBlockDevices: ec2.InstanceEbsBlockDeviceArray{
 			&ec2.InstanceEbsBlockDeviceArgs{
 				DeviceName: pulumi.String("/dev/sda1"),
-				VolumeSize: pulumi.Int(rootVolSize), // Set the desired size in GiB
+				VolumeSize: pulumi.Int(role.RootVolumeSize), // Set the desired size in GiB
 			},
 		},
 	})
@@ -0,0 +1,102 @@
+package resources
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ec2"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi/config"
+)
+
+// Default room in the admin prefix lists. Every security group rule that references a list counts as MaxEntries
+// rules against the group's quota, so this stays small; sshPrefixListMaxEntries raises it.
+const defaultAdminPrefixListMaxEntries = 10
+
+// AdminPrefixLists are the managed prefix lists holding the admins' sshCIDRs. Either is nil when sshCIDRs has no
+// entries of its address family.
+type AdminPrefixLists struct {
+	IPv4 *ec2.ManagedPrefixList
+	IPv6 *ec2.ManagedPrefixList
+}
+
+// StackOutputs are the IDs of the lists that exist, as CreateAdminPrefixLists exports them.
+func (l *AdminPrefixLists) StackOutputs() pulumi.Map {
+	exports := pulumi.Map{}
+	if l.IPv4 != nil {
+		exports["sshPrefixListId"] = l.IPv4.ID()
+	}
+	if l.IPv6 != nil {
+		exports["sshIpv6PrefixListId"] = l.IPv6.ID()
+	}
+	return exports
+}
+
+// CreateAdminPrefixLists keeps the sshCIDRs in managed prefix lists, one for the IPv4 and one for the IPv6
+// entries, so that security groups can admit the admins with a single rule per address family and editing the
+// CIDRs only touches the lists. A list is only created for a family with entries. The list IDs are exported for
+// other stacks that want to admit the same admins.
+func CreateAdminPrefixLists(ctx *pulumi.Context, cfg *config.Config) (*AdminPrefixLists, error) {
+	resourcePrefix := cfg.Require("resourcePrefix")
+
+	var ipv4, ipv6 []string
+	for _, cidr := range getSSHCIDRs(cfg) {
+		if strings.Contains(cidr, ":") {
+			ipv6 = append(ipv6, cidr)
+		} else {
+			ipv4 = append(ipv4, cidr)
+		}
+	}
+
+	maxEntries := cfg.GetInt("sshPrefixListMaxEntries")
+	if maxEntries == 0 {
+		maxEntries = defaultAdminPrefixListMaxEntries
+	}
+
+	lists := &AdminPrefixLists{}
+	for _, family := range []struct {
+		name          string
+		addressFamily string
+		cidrs         []string
+		list          **ec2.ManagedPrefixList
+	}{
+		{"ssh-prefix-list", "IPv4", ipv4, &lists.IPv4},
+		{"ssh-ipv6-prefix-list", "IPv6", ipv6, &lists.IPv6},
+	} {
+		if len(family.cidrs) == 0 {
+			continue
+		}
+		if len(family.cidrs) > maxEntries {
+			return nil, fmt.Errorf("%d %s sshCIDRs do not fit in a prefix list of %d entries, raise sshPrefixListMaxEntries",
+				len(family.cidrs), family.addressFamily, maxEntries)
+		}
+
+		var entries ec2.ManagedPrefixListEntryTypeArray
+		for _, cidr := range family.cidrs {
+			entries = append(entries, &ec2.ManagedPrefixListEntryTypeArgs{
+				Cidr:        pulumi.String(cidr),
+				Description: pulumi.String("Admin SSH access"),
+			})
+		}
+
+		list, err := ec2.NewManagedPrefixList(ctx, resourcePrefix+family.name, &ec2.ManagedPrefixListArgs{
+			Name:          pulumi.String(resourcePrefix + family.name),
+			AddressFamily: pulumi.String(family.addressFamily),
+			MaxEntries:    pulumi.Int(maxEntries),
+			Entries:       entries,
+			Tags: pulumi.StringMap{
+				"Name": pulumi.String(resourcePrefix + family.name),
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		*family.list = list
+	}
+
+	for key, value := range lists.StackOutputs() {
+		ctx.Export(key, value)
+	}
+	return lists, nil
+}
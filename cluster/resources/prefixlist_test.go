@@ -0,0 +1,83 @@
+package resources
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi/config"
+)
+
+// createAdminPrefixLists runs CreateAdminPrefixLists for the sshCIDRs and sshPrefixListMaxEntries, and returns the
+// keys of its exports.
+func createAdminPrefixLists(t *testing.T, cidrs, maxEntries string) ([]string, *amiMocks, error) {
+	t.Helper()
+	t.Setenv(pulumi.EnvConfig, `{
+		"copr-pulumi-go-aws:resourcePrefix": "copr-test-",
+		"copr-pulumi-go-aws:sshCIDRs": "`+cidrs+`",
+		"copr-pulumi-go-aws:sshPrefixListMaxEntries": "`+maxEntries+`"
+	}`)
+	m := &amiMocks{}
+	var exports []string
+	err := pulumi.RunErr(func(ctx *pulumi.Context) error {
+		lists, err := CreateAdminPrefixLists(ctx, config.New(ctx, "copr-pulumi-go-aws"))
+		if err != nil {
+			return err
+		}
+		for key := range lists.StackOutputs() {
+			exports = append(exports, key)
+		}
+		return nil
+	}, pulumi.WithMocks("copr-pulumi-go-aws", "test", m))
+	sort.Strings(exports)
+	return exports, m, err
+}
+
+func TestAdminPrefixLists(t *testing.T) {
+	exports, m, err := createAdminPrefixLists(t, `[\"192.0.2.0/24\", \"2001:db8::/48\", \"198.51.100.7/32\"]`, "0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each address family gets a list of its own
+	for name, want := range map[string]string{
+		"copr-test-ssh-prefix-list":      "IPv4 192.0.2.0/24 198.51.100.7/32",
+		"copr-test-ssh-ipv6-prefix-list": "IPv6 2001:db8::/48",
+	} {
+		inputs, ok := m.inputs[name]
+		if !ok {
+			t.Errorf("no prefix list %s", name)
+			continue
+		}
+		got := []string{inputs["addressFamily"].StringValue()}
+		for _, entry := range inputs["entries"].ArrayValue() {
+			got = append(got, entry.ObjectValue()["cidr"].StringValue())
+		}
+		if strings.Join(got, " ") != want {
+			t.Errorf("prefix list %s holds %v, want %s", name, got, want)
+		}
+		if inputs["maxEntries"].NumberValue() != defaultAdminPrefixListMaxEntries {
+			t.Errorf("prefix list %s has room for %v entries", name, inputs["maxEntries"])
+		}
+	}
+	if got := strings.Join(exports, " "); got != "sshIpv6PrefixListId sshPrefixListId" {
+		t.Errorf("got exports %s, want both list IDs", got)
+	}
+
+	// No list, and no export, for a family without CIDRs
+	exports, m, err = createAdminPrefixLists(t, `[\"192.0.2.0/24\"]`, "0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.resources) != 1 || strings.Join(exports, " ") != "sshPrefixListId" {
+		t.Errorf("got prefix lists %v and exports %v, want the IPv4 one only", m.resources, exports)
+	}
+
+	_, m, err = createAdminPrefixLists(t, `[\"192.0.2.0/24\", \"192.0.2.1/32\", \"2001:db8::/48\"]`, "1")
+	if err == nil || !strings.Contains(err.Error(), "2 IPv4 sshCIDRs do not fit in a prefix list of 1 entries") {
+		t.Errorf("CreateAdminPrefixLists() error = %v, want the IPv4 list to overflow", err)
+	}
+	if len(m.resources) != 0 {
+		t.Errorf("created %v before rejecting the CIDRs", m.resources)
+	}
+}
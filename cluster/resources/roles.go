@@ -0,0 +1,200 @@
+package resources
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ec2"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi/config"
+)
+
+// Subnet tiers a role can run in
+const (
+	SubnetTierPublic  = "public"
+	SubnetTierPrivate = "private"
+)
+
+// Root volume of a role that does not set rootVolumeSize
+const defaultRootVolumeSize = 30
+
+// RoleArgs is one entry of the roles config map, keyed by role name.
+type RoleArgs struct {
+	// InstanceType defaults to instanceTypeBackend
+	InstanceType string `json:"instanceType"`
+	// RootVolumeSize is in GiB
+	RootVolumeSize int       `json:"rootVolumeSize"`
+	Image          ImageArgs `json:"image"`
+	// SubnetTier is public or private. Only public instances get a public IP and a record in the public zone.
+	SubnetTier string `json:"subnetTier"`
+	// SecurityGroups names groups of SecurityGroups to add to the internal group and the role's own group, if there
+	// is one of the same name
+	SecurityGroups []string `json:"securityGroups"`
+	// Count defaults to 1. A count of 0 keeps the role, and its image pin, without instances.
+	Count int `json:"count"`
+	// LoadBalanced puts the role's instances behind the ALB
+	LoadBalanced bool `json:"loadBalanced"`
+}
+
+// UnmarshalJSON reads a roles config map entry, with a count of 1 unless it says otherwise.
+func (r *RoleArgs) UnmarshalJSON(data []byte) error {
+	type roleArgs RoleArgs
+	role := roleArgs{Count: 1}
+	if err := json.Unmarshal(data, &role); err != nil {
+		return err
+	}
+	*r = RoleArgs(role)
+	return nil
+}
+
+// getRoles reads the roles config map. Stacks that predate it get the table the provisionStandalone* keys describe.
+func getRoles(cfg *config.Config) (map[string]RoleArgs, error) {
+	var roles map[string]RoleArgs
+	if err := cfg.GetObject("roles", &roles); err != nil {
+		return nil, err
+	}
+	if roles == nil {
+		return legacyRoles(cfg), nil
+	}
+
+	for name, role := range roles {
+		if role.InstanceType == "" {
+			role.InstanceType = cfg.Require("instanceTypeBackend")
+		}
+		if role.RootVolumeSize == 0 {
+			role.RootVolumeSize = defaultRootVolumeSize
+		}
+		if role.SubnetTier == "" {
+			role.SubnetTier = SubnetTierPublic
+		}
+		if role.SubnetTier != SubnetTierPublic && role.SubnetTier != SubnetTierPrivate {
+			return nil, fmt.Errorf("role %s: unknown subnetTier %q, want %s or %s",
+				name, role.SubnetTier, SubnetTierPublic, SubnetTierPrivate)
+		}
+		if role.Count < 0 {
+			return nil, fmt.Errorf("role %s: count %d is negative", name, role.Count)
+		}
+		roles[name] = role
+	}
+	return roles, nil
+}
+
+// legacyRoles builds the roles the cluster had before the roles config map, sized exactly as they were so that
+// moving to the table does not touch running instances.
+func legacyRoles(cfg *config.Config) map[string]RoleArgs {
+	instanceType := cfg.Require("instanceTypeBackend")
+	rootSize := cfg.GetInt("instanceRootVolSizeBackend")
+	standaloneRootSize := rootSize
+	if standaloneRootSize == 0 {
+		standaloneRootSize = defaultRootVolumeSize
+	}
+
+	// Please note that "backend" is named such because it is the executing engine of COPR, not the due to the
+	// typical frontend/backend development architecture. It is not the backend of the application.
+	backend := RoleArgs{
+		InstanceType:   instanceType,
+		RootVolumeSize: rootSize,
+		SubnetTier:     SubnetTierPublic,
+		Count:          1,
+		LoadBalanced:   true,
+	}
+	roles := map[string]RoleArgs{"backend": backend}
+
+	for _, standalone := range []struct {
+		name string
+		key  string
+	}{
+		{"frontend", "provisionStandaloneFrontend"},
+		{"distgit", "provisionStandaloneDistGit"},
+		{"keygen", "provisionStandaloneKeyGen"},
+	} {
+		if !cfg.GetBool(standalone.key) {
+			continue
+		}
+		roles[standalone.name] = RoleArgs{
+			InstanceType:   instanceType,
+			RootVolumeSize: standaloneRootSize,
+			SubnetTier:     SubnetTierPublic,
+			Count:          1,
+			LoadBalanced:   standalone.name == "frontend",
+		}
+	}
+
+	// Without a frontend of its own the backend serves the frontend too
+	if _, ok := roles["frontend"]; ok {
+		backend.LoadBalanced = false
+	} else {
+		backend.SecurityGroups = []string{"frontend"}
+	}
+	roles["backend"] = backend
+	return roles
+}
+
+// roleInstanceName names the instances of a role: the first one after the role, the others numbered from 2, so that
+// raising the count leaves the existing instance alone.
+func roleInstanceName(role string, i int) string {
+	if i == 0 {
+		return role
+	}
+	return fmt.Sprintf("%s-%d", role, i+1)
+}
+
+// RoleInstances are the instances of the roles config map.
+type RoleInstances struct {
+	ByRole map[string][]*ec2.Instance
+	// LoadBalanced are the instances of the roles behind the ALB
+	LoadBalanced []*ec2.Instance
+}
+
+// CreateRoles creates the instances of every role in the roles config map, on the images pins resolves.
+func CreateRoles(ctx *pulumi.Context, cfg *config.Config, sGroups *SecurityGroups, pins *ImagePins) (*RoleInstances, error) {
+	roles, err := getRoles(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create the roles in a stable order
+	names := make([]string, 0, len(roles))
+	for name := range roles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	instances := &RoleInstances{ByRole: map[string][]*ec2.Instance{}}
+	for _, name := range names {
+		role := roles[name]
+
+		var sgs []*ec2.SecurityGroup
+		if own, ok := sGroups.ByName(name); ok {
+			sgs = append(sgs, own)
+		}
+		sgs = append(sgs, sGroups.Internal)
+		for _, sgName := range role.SecurityGroups {
+			sg, ok := sGroups.ByName(sgName)
+			if !ok {
+				return nil, fmt.Errorf("role %s: unknown security group %q, want one of %v",
+					name, sgName, SecurityGroupNames)
+			}
+			sgs = append(sgs, sg)
+		}
+
+		// Every instance of a role runs the same image
+		image, err := pins.Resolve(ctx, name, role.Image, cfg.Require("resourcePrefix")+roleInstanceName(name, 0))
+		if err != nil {
+			return nil, err
+		}
+
+		for i := 0; i < role.Count; i++ {
+			inst, err := CreateInstance(ctx, cfg, roleInstanceName(name, i), i, role, image, sgs)
+			if err != nil {
+				return nil, err
+			}
+			instances.ByRole[name] = append(instances.ByRole[name], inst)
+			if role.LoadBalanced {
+				instances.LoadBalanced = append(instances.LoadBalanced, inst)
+			}
+		}
+	}
+	return instances, nil
+}
@@ -0,0 +1,119 @@
+package resources
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi/config"
+)
+
+// rolesFromConfig reads the roles out of the stack configuration cfg, a JSON object of config keys.
+func rolesFromConfig(t *testing.T, cfg string) (map[string]RoleArgs, error) {
+	t.Helper()
+	t.Setenv(pulumi.EnvConfig, cfg)
+	var roles map[string]RoleArgs
+	var err error
+	_ = pulumi.RunErr(func(ctx *pulumi.Context) error {
+		roles, err = getRoles(config.New(ctx, "copr-pulumi-go-aws"))
+		return err
+	}, pulumi.WithMocks("copr-pulumi-go-aws", "test", stackMocks{}))
+	return roles, err
+}
+
+func TestLegacyRoles(t *testing.T) {
+	roles, err := rolesFromConfig(t, `{
+		"copr-pulumi-go-aws:instanceTypeBackend": "m7i.large",
+		"copr-pulumi-go-aws:provisionStandaloneFrontend": "true",
+		"copr-pulumi-go-aws:provisionStandaloneKeyGen": "true"
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]RoleArgs{
+		// The backend keeps the unset root volume size it always had
+		"backend":  {InstanceType: "m7i.large", SubnetTier: SubnetTierPublic, Count: 1},
+		"frontend": {InstanceType: "m7i.large", RootVolumeSize: 30, SubnetTier: SubnetTierPublic, Count: 1, LoadBalanced: true},
+		"keygen":   {InstanceType: "m7i.large", RootVolumeSize: 30, SubnetTier: SubnetTierPublic, Count: 1},
+	}
+	if !reflect.DeepEqual(roles, want) {
+		t.Errorf("got roles %+v, want %+v", roles, want)
+	}
+
+	// Without a standalone frontend the backend serves it
+	roles, err = rolesFromConfig(t, `{"copr-pulumi-go-aws:instanceTypeBackend": "m7i.large"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backend := roles["backend"]; len(roles) != 1 || !backend.LoadBalanced ||
+		!reflect.DeepEqual(backend.SecurityGroups, []string{"frontend"}) {
+		t.Errorf("got roles %+v, want a load balanced backend in the frontend group", roles)
+	}
+}
+
+func TestRoles(t *testing.T) {
+	roles, err := rolesFromConfig(t, `{
+		"copr-pulumi-go-aws:instanceTypeBackend": "m7i.large",
+		"copr-pulumi-go-aws:roles": "{\"backend\": {\"instanceType\": \"c7i.xlarge\", \"count\": 2}, \"keygen\": {\"subnetTier\": \"private\"}, \"frontend\": {\"count\": 0}}"
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]RoleArgs{
+		"backend": {InstanceType: "c7i.xlarge", RootVolumeSize: 30, SubnetTier: SubnetTierPublic, Count: 2},
+		"keygen":  {InstanceType: "m7i.large", RootVolumeSize: 30, SubnetTier: SubnetTierPrivate, Count: 1},
+		// A count of 0 is kept rather than defaulted
+		"frontend": {InstanceType: "m7i.large", RootVolumeSize: 30, SubnetTier: SubnetTierPublic, Count: 0},
+	}
+	if !reflect.DeepEqual(roles, want) {
+		t.Errorf("got roles %+v, want %+v", roles, want)
+	}
+
+	_, err = rolesFromConfig(t, `{
+		"copr-pulumi-go-aws:instanceTypeBackend": "m7i.large",
+		"copr-pulumi-go-aws:roles": "{\"backend\": {\"subnetTier\": \"isolated\"}}"
+	}`)
+	if err == nil || !strings.Contains(err.Error(), "unknown subnetTier") {
+		t.Fatalf("getRoles() error = %v, want an unknown subnet tier", err)
+	}
+
+	if got := roleInstanceName("backend", 0) + " " + roleInstanceName("backend", 1); got != "backend backend-2" {
+		t.Errorf("got instance names %s", got)
+	}
+}
+
+func TestSpreadSubnet(t *testing.T) {
+	subnets := pulumi.ToStringArray([]string{"subnet-a", "subnet-b", "subnet-c"})
+	var got []string
+	// Applies on known outputs are not waited for by the run
+	done := make(chan struct{})
+	err := pulumi.RunErr(func(ctx *pulumi.Context) error {
+		var picked []interface{}
+		for i := 0; i < 5; i++ {
+			picked = append(picked, spreadSubnet(subnets.ToStringArrayOutput(), i))
+		}
+		pulumi.All(picked...).ApplyT(func(ids []interface{}) error {
+			for _, id := range ids {
+				got = append(got, id.(string))
+			}
+			close(done)
+			return nil
+		})
+		return nil
+	}, pulumi.WithMocks("copr-pulumi-go-aws", "test", stackMocks{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the subnets were never resolved")
+	}
+	// The first instance keeps the first subnet, the rest take turns over the others
+	if want := []string{"subnet-a", "subnet-b", "subnet-c", "subnet-a", "subnet-b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got subnets %v, want %v", got, want)
+	}
+}
@@ -20,9 +20,31 @@ type SecurityGroups struct {
 	Builder  *ec2.SecurityGroup
 }
 
+// SecurityGroupNames are the names roles refer to the security groups by, see ByName
+var SecurityGroupNames = []string{"internal", "backend", "frontend", "distgit", "keygen", "lb", "db", "builder"}
+
+// ByName returns the group a role refers to as name, one of SecurityGroupNames.
+func (sgs *SecurityGroups) ByName(name string) (*ec2.SecurityGroup, bool) {
+	sg := map[string]*ec2.SecurityGroup{
+		"internal": sgs.Internal,
+		"backend":  sgs.Backend,
+		"frontend": sgs.Frontend,
+		"distgit":  sgs.DistGit,
+		"keygen":   sgs.KeyGen,
+		"lb":       sgs.LB,
+		"db":       sgs.DB,
+		"builder":  sgs.Builder,
+	}[name]
+	return sg, sg != nil
+}
+
 func CreateSecurityGroups(ctx *pulumi.Context, config *config.Config) (*SecurityGroups, error) {
 	resourcePrefix := config.Require("resourcePrefix")
-	vpcID, err := GetVPCID(ctx, config.Require("vpcProjectName"))
+	vpcStack, err := VPCStackRef(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	vpcID, err := GetVPCID(ctx, vpcStack)
 	if err != nil {
 		return nil, err
 	}
@@ -199,16 +221,64 @@ func CreateSecurityGroups(ctx *pulumi.Context, config *config.Config) (*Security
 		return nil, err
 	}
 
-	// Add SSH Ingress to the internal Security Group
-	cidrs := getSSHCIDRs(config)
+	// The backend drives the builders over SSH, and the builders fetch sources and packages from anywhere
+	_, err = vpc.NewSecurityGroupIngressRule(ctx, resourcePrefix+"builder-ssh-ingress-from-backend-sg", &vpc.SecurityGroupIngressRuleArgs{
+		Description:               pulumi.String("Allow SSH from the backend to the builders"),
+		SecurityGroupId:           buildersg.ID(),
+		ReferencedSecurityGroupId: besg.ID(),
+		IpProtocol:                pulumi.String("tcp"),
+		FromPort:                  pulumi.Int(22),
+		ToPort:                    pulumi.Int(22),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, cidr := range []string{"0.0.0.0/0", "::/0"} {
+		args := &vpc.SecurityGroupEgressRuleArgs{
+			Description:     pulumi.String("Allow all traffic out of the builders"),
+			SecurityGroupId: buildersg.ID(),
+			IpProtocol:      pulumi.String("-1"),
+			FromPort:        pulumi.Int(0),
+			ToPort:          pulumi.Int(0),
+		}
+		family := "ipv4"
+		if cidr == "::/0" {
+			family = "ipv6"
+			args.CidrIpv6 = pulumi.String(cidr)
+		} else {
+			args.CidrIpv4 = pulumi.String(cidr)
+		}
+		_, err = vpc.NewSecurityGroupEgressRule(ctx, resourcePrefix+"builder-all-"+family+"-egress-sgr", args)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	for _, cidr := range cidrs {
+	// Add SSH Ingress to the internal Security Group, one rule per admin prefix list
+	prefixLists, err := CreateAdminPrefixLists(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, family := range []struct {
+		name string
+		list *ec2.ManagedPrefixList
+	}{
+		{"ssh", prefixLists.IPv4},
+		{"ssh-ipv6", prefixLists.IPv6},
+	} {
+		if family.list == nil {
+			continue
+		}
 		_, err := vpc.NewSecurityGroupIngressRule(
-			ctx, resourcePrefix+"internal-ingress-ssh:"+cidr, &vpc.SecurityGroupIngressRuleArgs{
-				Description:     pulumi.String("Allow SSH traffic from " + cidr),
+			ctx, resourcePrefix+"internal-ingress-"+family.name+"-prefix-list", &vpc.SecurityGroupIngressRuleArgs{
+				Description:     pulumi.String("Allow SSH traffic from the admin prefix list"),
 				SecurityGroupId: isg.ID(),
-				IpProtocol:      pulumi.String("-1"),
-				CidrIpv4:        pulumi.String(cidr),
+				IpProtocol:      pulumi.String("tcp"),
+				FromPort:        pulumi.Int(22),
+				ToPort:          pulumi.Int(22),
+				PrefixListId:    family.list.ID(),
 			})
 		if err != nil {
 			return nil, err
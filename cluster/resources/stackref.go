@@ -1,10 +1,15 @@
 package resources
 
 import (
+	"errors"
+	"fmt"
 	"strings"
 	"sync"
 
+	"copr-pulumi-go-aws-outputs"
+
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi/config"
 )
 
 type stackRefResult struct {
@@ -12,35 +17,126 @@ type stackRefResult struct {
 	err error
 }
 
+// Stack references are read once per program and stack
+type stackRefKey struct {
+	ctx  *pulumi.Context
+	name string
+}
+
 var (
-	vpcStackRefs     = make(map[string]stackRefResult)
-	vpcStackRefsLock sync.Mutex
+	stackRefs     = make(map[stackRefKey]stackRefResult)
+	stackRefsLock sync.Mutex
 )
 
-func GetStackRef(ctx *pulumi.Context, project string) (*pulumi.StackReference, error) {
+// VPCStackRef names the stack to read the VPC outputs from: vpcStackRef when it is set, which lets several clusters
+// share one VPC stack, otherwise the stack of vpcProjectName named like the current stack.
+func VPCStackRef(ctx *pulumi.Context, cfg *config.Config) (string, error) {
+	return stackRefName(ctx, cfg, "vpcStackRef", "vpcProjectName")
+}
+
+// CertsStackRef names the stack to read the certificate outputs from: certsStackRef when it is set, otherwise the
+// stack of certsProjectName named like the current stack.
+func CertsStackRef(ctx *pulumi.Context, cfg *config.Config) (string, error) {
+	return stackRefName(ctx, cfg, "certsStackRef", "certsProjectName")
+}
+
+func stackRefName(ctx *pulumi.Context, cfg *config.Config, refKey string, projectKey string) (string, error) {
+	if ref := cfg.Get(refKey); ref != "" {
+		parts := strings.Split(ref, "/")
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return "", fmt.Errorf("%s must be a fully qualified org/project/stack, got %q", refKey, ref)
+		}
+		return ref, nil
+	}
 
-	callStack := ctx.Stack()
-	parts := strings.Split(callStack, "/")
+	parts := strings.Split(ctx.Stack(), "/")
 	stackName := parts[len(parts)-1]
+	return cfg.Require(projectKey) + "/" + stackName, nil
+}
 
-	vpcStackRefsLock.Lock()
-	defer vpcStackRefsLock.Unlock()
+// GetStackRef references the stack named name, as returned by VPCStackRef or CertsStackRef. The reference is shared
+// by everything that reads the stack; its outputs are only waited for, and a stack that does not exist only noticed,
+// by RequireOutputs.
+func GetStackRef(ctx *pulumi.Context, name string) (*pulumi.StackReference, error) {
+	stackRefsLock.Lock()
+	defer stackRefsLock.Unlock()
 
-	if result, exists := vpcStackRefs[project]; exists {
+	key := stackRefKey{ctx, name}
+	if result, exists := stackRefs[key]; exists {
 		return result.ref, result.err
 	}
 
-	ref, err := pulumi.NewStackReference(ctx, project+"/"+stackName, nil)
+	ref, err := pulumi.NewStackReference(ctx, name, nil)
 	result := stackRefResult{ref: ref, err: err}
 
-	vpcStackRefs[project] = result
+	stackRefs[key] = result
 
 	return ref, err
 }
 
-func getReferenceValue(ctx *pulumi.Context, project string, key string) (pulumi.StringOutput, error) {
-	stackRef, err := GetStackRef(ctx, project)
+// RequireOutputs checks that stack exports each of keys, with the shape the outputs contract gives it. Rather than
+// stopping at the first, it reports every missing or malformed output in one error.
+func RequireOutputs(ctx *pulumi.Context, stack string, keys ...string) error {
+	stackRef, err := GetStackRef(ctx, stack)
+	if err != nil {
+		return err
+	}
+
+	var problems []error
+	for _, key := range keys {
+		details, err := stackRef.GetOutputDetails(key)
+		if err != nil {
+			// The stack could not be read at all, every other key would fail the same way
+			return fmt.Errorf("could not read stack %s, check that it exists and has been deployed: %w", stack, err)
+		}
+		value := details.Value
+		if value == nil {
+			value = details.SecretValue
+		}
+		if value == nil {
+			problems = append(problems, fmt.Errorf("stack %s does not export %s", stack, key))
+			continue
+		}
+		if err := outputs.Check(key, value); err != nil {
+			problems = append(problems, fmt.Errorf("stack %s: %w", stack, err))
+		}
+	}
+	return errors.Join(problems...)
+}
+
+// ValidateStackRefs checks, before anything is created, that the VPC and certs stacks export everything the cluster
+// reads from them with the current configuration. All the problems of both stacks are reported at once.
+func ValidateStackRefs(ctx *pulumi.Context, cfg *config.Config) error {
+	vpcStack, err := VPCStackRef(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	certsStack, err := CertsStackRef(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	vpcKeys := []string{
+		outputs.VpcID, outputs.PublicSubnets, outputs.PrivateSubnets,
+		outputs.PublicHostedZoneID, outputs.PrivateHostedZoneID, outputs.PublicDomainName, outputs.PrivateDomainName,
+	}
+	if cfg.GetBool("provisionStandaloneDB") {
+		vpcKeys = append(vpcKeys, outputs.DbSubnetGroupName)
+	}
+
+	return errors.Join(
+		RequireOutputs(ctx, vpcStack, vpcKeys...),
+		RequireOutputs(ctx, certsStack, outputs.ALBCertARN, outputs.ALBCertSubjectAlternativeNames),
+	)
+}
+
+// getReferenceValue reads a string output of another stack. key is one of the output names of the outputs package.
+func getReferenceValue(ctx *pulumi.Context, stack string, key string) (pulumi.StringOutput, error) {
+	if err := RequireOutputs(ctx, stack, key); err != nil {
+		return pulumi.String("").ToStringOutput(), err
+	}
 
+	stackRef, err := GetStackRef(ctx, stack)
 	if err != nil {
 		return pulumi.String("").ToStringOutput(), err
 	}
@@ -50,44 +146,68 @@ func getReferenceValue(ctx *pulumi.Context, project string, key string) (pulumi.
 	return value, nil
 }
 
-func GetVPCID(ctx *pulumi.Context, project string) (pulumi.StringOutput, error) {
-	return getReferenceValue(ctx, project, "vpcId")
+// getReferenceArray reads a list output of another stack, like getReferenceValue.
+func getReferenceArray(ctx *pulumi.Context, stack string, key string) (pulumi.StringArrayOutput, error) {
+	if err := RequireOutputs(ctx, stack, key); err != nil {
+		return pulumi.StringArrayOutput{}, err
+	}
+
+	stackRef, err := GetStackRef(ctx, stack)
+	if err != nil {
+		return pulumi.StringArrayOutput{}, err
+	}
+
+	value := stackRef.GetOutput(pulumi.String(key)).AsStringArrayOutput()
+
+	return value, nil
 }
 
-func GetPublicHostedZoneID(ctx *pulumi.Context, project string) (pulumi.StringOutput, error) {
-	return getReferenceValue(ctx, project, "publicHostedZoneId")
+func GetVPCID(ctx *pulumi.Context, stack string) (pulumi.StringOutput, error) {
+	return getReferenceValue(ctx, stack, outputs.VpcID)
 }
 
-func GetPrivateHostedZoneID(ctx *pulumi.Context, project string) (pulumi.StringOutput, error) {
-	return getReferenceValue(ctx, project, "privateHostedZoneId")
+func GetPublicHostedZoneID(ctx *pulumi.Context, stack string) (pulumi.StringOutput, error) {
+	return getReferenceValue(ctx, stack, outputs.PublicHostedZoneID)
 }
 
-func GetPublicDomainName(ctx *pulumi.Context, project string) (pulumi.StringOutput, error) {
-	return getReferenceValue(ctx, project, "publicDomainName")
+func GetPrivateHostedZoneID(ctx *pulumi.Context, stack string) (pulumi.StringOutput, error) {
+	return getReferenceValue(ctx, stack, outputs.PrivateHostedZoneID)
 }
 
-func GetPrivateDomainName(ctx *pulumi.Context, project string) (pulumi.StringOutput, error) {
-	return getReferenceValue(ctx, project, "privateDomainName")
+func GetPublicDomainName(ctx *pulumi.Context, stack string) (pulumi.StringOutput, error) {
+	return getReferenceValue(ctx, stack, outputs.PublicDomainName)
 }
 
-func GetSubnets(ctx *pulumi.Context, project string, public bool) (pulumi.StringArrayOutput, error) {
-	stackRef, err := GetStackRef(ctx, project)
+func GetPrivateDomainName(ctx *pulumi.Context, stack string) (pulumi.StringOutput, error) {
+	return getReferenceValue(ctx, stack, outputs.PrivateDomainName)
+}
 
-	if err != nil {
-		return pulumi.StringArrayOutput{}, err
-	}
-	key := "publicSubnets"
+// GetDBSubnetGroupName returns the RDS subnet group spanning the VPC stack's isolated database subnets. The VPC
+// stack only exports it when it has a database tier.
+func GetDBSubnetGroupName(ctx *pulumi.Context, stack string) (pulumi.StringOutput, error) {
+	return getReferenceValue(ctx, stack, outputs.DbSubnetGroupName)
+}
+
+func GetSubnets(ctx *pulumi.Context, stack string, public bool) (pulumi.StringArrayOutput, error) {
+	key := outputs.PublicSubnets
 	if !public {
-		key = "privateSubnets"
+		key = outputs.PrivateSubnets
 	}
+	return getReferenceArray(ctx, stack, key)
+}
 
-	value := stackRef.GetOutput(pulumi.String(key)).AsStringArrayOutput()
-
-	return value, nil
+// GetSubnetsIpv6CIDRs returns the IPv6 /64s of the VPC stack's subnets, in the same order as GetSubnets. The VPC
+// stack only exports these when it is built with enableIpv6.
+func GetSubnetsIpv6CIDRs(ctx *pulumi.Context, stack string, public bool) (pulumi.StringArrayOutput, error) {
+	key := outputs.PublicSubnetsIpv6CIDRs
+	if !public {
+		key = outputs.PrivateSubnetsIpv6CIDRs
+	}
+	return getReferenceArray(ctx, stack, key)
 }
 
-func GetFirstSubnet(ctx *pulumi.Context, project string, public bool) (pulumi.StringOutput, error) {
-	subnets, err := GetSubnets(ctx, project, public)
+func GetFirstSubnet(ctx *pulumi.Context, stack string, public bool) (pulumi.StringOutput, error) {
+	subnets, err := GetSubnets(ctx, stack, public)
 
 	if err != nil {
 		return pulumi.String("").ToStringOutput(), err
@@ -96,20 +216,14 @@ func GetFirstSubnet(ctx *pulumi.Context, project string, public bool) (pulumi.St
 	return subnets.Index(pulumi.Int(0)), nil
 }
 
-func GetALBCertARN(ctx *pulumi.Context, project string) (pulumi.StringOutput, error) {
-	return getReferenceValue(ctx, project, "ALBCertARN")
+func GetALBCertARN(ctx *pulumi.Context, stack string) (pulumi.StringOutput, error) {
+	return getReferenceValue(ctx, stack, outputs.ALBCertARN)
 }
 
-func GetALBCertDomainName(ctx *pulumi.Context, project string) (pulumi.StringOutput, error) {
-	return getReferenceValue(ctx, project, "ALBCertDomainName")
+func GetALBCertDomainName(ctx *pulumi.Context, stack string) (pulumi.StringOutput, error) {
+	return getReferenceValue(ctx, stack, outputs.ALBCertDomainName)
 }
 
-func GetALBCertSubjectAlternativeNames(ctx *pulumi.Context, project string) (pulumi.StringArrayOutput, error) {
-	stackRef, err := GetStackRef(ctx, project)
-	if err != nil {
-		return pulumi.StringArrayOutput{}, err
-	}
-
-	value := stackRef.GetOutput(pulumi.String("ALBCertSubjectAlternativeNames")).AsStringArrayOutput()
-	return value, nil
+func GetALBCertSubjectAlternativeNames(ctx *pulumi.Context, stack string) (pulumi.StringArrayOutput, error) {
+	return getReferenceArray(ctx, stack, outputs.ALBCertSubjectAlternativeNames)
 }
@@ -0,0 +1,265 @@
+package resources
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"copr-pulumi-go-aws-outputs"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi/config"
+)
+
+// stackMocks serves stack references to the vpc and certs projects with exactly the outputs of the contract, each set
+// to a value derived from its name. Stacks named missing do not exist, and the vpc stack named partial exports only a
+// VPC ID and a malformed list of public subnets.
+type stackMocks struct{}
+
+func (stackMocks) NewResource(args pulumi.MockResourceArgs) (string, resource.PropertyMap, error) {
+	state := args.Inputs.Copy()
+	if args.TypeToken == "pulumi:pulumi:StackReference" {
+		if strings.HasSuffix(args.Name, "/missing") {
+			return "", nil, fmt.Errorf("unknown stack %q", args.Name)
+		}
+		var stack interface{} = outputs.VPC{}
+		if strings.Contains(args.Name, "certs/") {
+			stack = outputs.Certs{}
+		}
+		values := contractOutputs(stack)
+		if strings.HasSuffix(args.Name, "/partial") {
+			values = resource.PropertyMap{
+				outputs.VpcID:         resource.NewStringProperty("vpc-0copr"),
+				outputs.PublicSubnets: resource.NewStringProperty("subnet-0a"),
+			}
+		}
+		state["name"] = resource.NewStringProperty(args.Name)
+		state["outputs"] = resource.NewObjectProperty(values)
+	}
+	return args.Name + "-id", state, nil
+}
+
+func (stackMocks) Call(args pulumi.MockCallArgs) (resource.PropertyMap, error) {
+	return args.Args, nil
+}
+
+func contractOutputs(stack interface{}) resource.PropertyMap {
+	values := resource.PropertyMap{}
+	t := reflect.TypeOf(stack)
+	for i := 0; i < t.NumField(); i++ {
+		key, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		values[resource.PropertyKey(key)] = exampleValue(t.Field(i).Type, key)
+	}
+	return values
+}
+
+// exampleValue returns a value of type typ made of value.
+func exampleValue(typ reflect.Type, value string) resource.PropertyValue {
+	switch typ.Kind() {
+	case reflect.Slice:
+		return resource.NewArrayProperty([]resource.PropertyValue{exampleValue(typ.Elem(), value)})
+	case reflect.Map:
+		return resource.NewObjectProperty(resource.PropertyMap{"key": exampleValue(typ.Elem(), value)})
+	default:
+		return resource.NewStringProperty(value)
+	}
+}
+
+// TestReadKeysAreExported reads every output the cluster takes from the other stacks out of stacks that export
+// exactly the outputs contract.
+func TestReadKeysAreExported(t *testing.T) {
+	var mu sync.Mutex
+	read := map[string]interface{}{}
+	err := pulumi.RunErr(func(ctx *pulumi.Context) error {
+		strs := map[string]func(*pulumi.Context, string) (pulumi.StringOutput, error){
+			"GetVPCID":               GetVPCID,
+			"GetPublicHostedZoneID":  GetPublicHostedZoneID,
+			"GetPrivateHostedZoneID": GetPrivateHostedZoneID,
+			"GetPublicDomainName":    GetPublicDomainName,
+			"GetPrivateDomainName":   GetPrivateDomainName,
+			"GetDBSubnetGroupName":   GetDBSubnetGroupName,
+			"GetFirstSubnet": func(ctx *pulumi.Context, project string) (pulumi.StringOutput, error) {
+				return GetFirstSubnet(ctx, project, false)
+			},
+		}
+		arrays := map[string]func(*pulumi.Context, string) (pulumi.StringArrayOutput, error){
+			"GetSubnets(public)": func(ctx *pulumi.Context, project string) (pulumi.StringArrayOutput, error) {
+				return GetSubnets(ctx, project, true)
+			},
+			"GetSubnets(private)": func(ctx *pulumi.Context, project string) (pulumi.StringArrayOutput, error) {
+				return GetSubnets(ctx, project, false)
+			},
+			"GetSubnetsIpv6CIDRs(public)": func(ctx *pulumi.Context, project string) (pulumi.StringArrayOutput, error) {
+				return GetSubnetsIpv6CIDRs(ctx, project, true)
+			},
+			"GetSubnetsIpv6CIDRs(private)": func(ctx *pulumi.Context, project string) (pulumi.StringArrayOutput, error) {
+				return GetSubnetsIpv6CIDRs(ctx, project, false)
+			},
+		}
+		certStrs := map[string]func(*pulumi.Context, string) (pulumi.StringOutput, error){
+			"GetALBCertARN":        GetALBCertARN,
+			"GetALBCertDomainName": GetALBCertDomainName,
+		}
+
+		record := func(name string) func(interface{}) interface{} {
+			return func(value interface{}) interface{} {
+				mu.Lock()
+				defer mu.Unlock()
+				read[name] = value
+				return value
+			}
+		}
+		for project, getters := range map[string]map[string]func(*pulumi.Context, string) (pulumi.StringOutput, error){
+			"copr/vpc/test": strs, "copr/certs/test": certStrs,
+		} {
+			for name, get := range getters {
+				value, err := get(ctx, project)
+				if err != nil {
+					return err
+				}
+				value.ApplyT(record(name))
+			}
+		}
+		for name, get := range arrays {
+			value, err := get(ctx, "copr/vpc/test")
+			if err != nil {
+				return err
+			}
+			value.ApplyT(record(name))
+		}
+		sans, err := GetALBCertSubjectAlternativeNames(ctx, "copr/certs/test")
+		if err != nil {
+			return err
+		}
+		sans.ApplyT(record("GetALBCertSubjectAlternativeNames"))
+		return nil
+	}, pulumi.WithMocks("copr-pulumi-go-aws", "test", stackMocks{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An output the stack does not export never resolves
+	for _, name := range []string{
+		"GetVPCID", "GetPublicHostedZoneID", "GetPrivateHostedZoneID", "GetPublicDomainName", "GetPrivateDomainName",
+		"GetDBSubnetGroupName", "GetFirstSubnet", "GetSubnets(public)", "GetSubnets(private)",
+		"GetSubnetsIpv6CIDRs(public)", "GetSubnetsIpv6CIDRs(private)",
+		"GetALBCertARN", "GetALBCertDomainName", "GetALBCertSubjectAlternativeNames",
+	} {
+		if _, ok := read[name]; !ok {
+			t.Errorf("%s read an output the stack does not export", name)
+		}
+	}
+	for name, value := range read {
+		switch value := value.(type) {
+		case string:
+			if value == "" {
+				t.Errorf("%s read an output the stack does not export", name)
+			}
+		case []string:
+			if len(value) == 0 || value[0] == "" {
+				t.Errorf("%s read an output the stack does not export", name)
+			}
+		default:
+			t.Errorf("%s read %#v", name, value)
+		}
+	}
+}
+
+func TestStackRefName(t *testing.T) {
+	tests := []struct {
+		config string
+		want   string
+		err    string
+	}{
+		{`{"copr-pulumi-go-aws:vpcProjectName": "vpc"}`, "vpc/prod", ""},
+		{`{"copr-pulumi-go-aws:vpcStackRef": "copr/vpc/shared"}`, "copr/vpc/shared", ""},
+		{`{"copr-pulumi-go-aws:vpcStackRef": "vpc/shared"}`, "", "fully qualified"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.config, func(t *testing.T) {
+			t.Setenv(pulumi.EnvConfig, tt.config)
+			var got string
+			err := pulumi.RunErr(func(ctx *pulumi.Context) error {
+				var err error
+				got, err = VPCStackRef(ctx, config.New(ctx, "copr-pulumi-go-aws"))
+				return err
+			}, pulumi.WithMocks("copr-pulumi-go-aws", "prod", stackMocks{}))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("VPCStackRef() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("VPCStackRef() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMissingStack(t *testing.T) {
+	var err error
+	// The failed read fails the run as well, the error of interest is the one the program sees
+	_ = pulumi.RunErr(func(ctx *pulumi.Context) error {
+		_, err = GetVPCID(ctx, "copr/vpc/missing")
+		return err
+	}, pulumi.WithMocks("copr-pulumi-go-aws", "test", stackMocks{}))
+	if err == nil || !strings.Contains(err.Error(), "could not read stack copr/vpc/missing") {
+		t.Fatalf("GetVPCID() error = %v, want the missing stack", err)
+	}
+
+	// The certs stack is read the same way, though it has none of the VPC stack's outputs
+	_ = pulumi.RunErr(func(ctx *pulumi.Context) error {
+		_, err = GetALBCertARN(ctx, "copr/certs/missing")
+		return err
+	}, pulumi.WithMocks("copr-pulumi-go-aws", "test", stackMocks{}))
+	if err == nil || !strings.Contains(err.Error(), "could not read stack copr/certs/missing") {
+		t.Fatalf("GetALBCertARN() error = %v, want the missing stack", err)
+	}
+}
+
+func TestValidateStackRefs(t *testing.T) {
+	validate := func(vpcStack string) error {
+		t.Helper()
+		t.Setenv(pulumi.EnvConfig, `{
+			"copr-pulumi-go-aws:vpcStackRef": "copr/vpc/`+vpcStack+`",
+			"copr-pulumi-go-aws:certsStackRef": "copr/certs/test",
+			"copr-pulumi-go-aws:provisionStandaloneDB": "true"
+		}`)
+		var err error
+		_ = pulumi.RunErr(func(ctx *pulumi.Context) error {
+			err = ValidateStackRefs(ctx, config.New(ctx, "copr-pulumi-go-aws"))
+			return err
+		}, pulumi.WithMocks("copr-pulumi-go-aws", "test", stackMocks{}))
+		return err
+	}
+
+	if err := validate("test"); err != nil {
+		t.Fatalf("ValidateStackRefs() = %v, want the full contract to validate", err)
+	}
+
+	err := validate("partial")
+	if err == nil {
+		t.Fatal("ValidateStackRefs() accepted a stack without most outputs")
+	}
+	// Every problem is reported, not just the first
+	for _, want := range []string{
+		`stack copr/vpc/partial: publicSubnets is "subnet-0a", want a []string`,
+		"stack copr/vpc/partial does not export privateSubnets",
+		"stack copr/vpc/partial does not export privateDomainName",
+		"stack copr/vpc/partial does not export dbSubnetGroupName",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("ValidateStackRefs() = %v, want %q", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), "copr/certs/test") {
+		t.Errorf("ValidateStackRefs() = %v, the certs stack is complete", err)
+	}
+}
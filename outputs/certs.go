@@ -0,0 +1,15 @@
+package outputs
+
+// Outputs of the certs stack
+const (
+	ALBCertARN                     = "ALBCertARN"
+	ALBCertDomainName              = "ALBCertDomainName"
+	ALBCertSubjectAlternativeNames = "ALBCertSubjectAlternativeNames"
+)
+
+// Certs are the outputs of the certs stack.
+type Certs struct {
+	ALBCertARN                     string   `json:"ALBCertARN"`
+	ALBCertDomainName              string   `json:"ALBCertDomainName"`
+	ALBCertSubjectAlternativeNames []string `json:"ALBCertSubjectAlternativeNames"`
+}
@@ -0,0 +1,3 @@
+module copr-pulumi-go-aws-outputs
+
+go 1.22.5
@@ -0,0 +1,79 @@
+// Package outputs is the contract between the stacks: the names of the outputs the vpc and certs stacks export and
+// the cluster and certs stacks read back through stack references, and their shape as Go structs.
+//
+// Exporters and readers both use the constants instead of bare strings, so that a renamed output is caught by the
+// tests of both sides instead of at deploy time. The structs decode `pulumi stack output --json`; fields tagged
+// omitempty are only exported when the feature behind them is enabled.
+package outputs
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Keys returns the names of all outputs of a stack, given its struct, e.g. Keys(VPC{}).
+func Keys(stack interface{}) []string {
+	return keys(stack, true)
+}
+
+// RequiredKeys returns the names of the outputs a stack always exports, whatever its configuration.
+func RequiredKeys(stack interface{}) []string {
+	return keys(stack, false)
+}
+
+// Check returns an error when value, an output read back from a stack, does not have the shape the contract gives
+// the output key: a string output that is not a non-empty string, a list that is not a list of strings and so on.
+func Check(key string, value interface{}) error {
+	field, ok := fieldType(key)
+	if !ok {
+		return fmt.Errorf("%s is not an output of any stack", key)
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	decoded := reflect.New(field)
+	if value == nil || json.Unmarshal(raw, decoded.Interface()) != nil {
+		return fmt.Errorf("%s is %s, want a %s", key, raw, field)
+	}
+	if field.Kind() == reflect.String && decoded.Elem().Len() == 0 {
+		return fmt.Errorf("%s is empty", key)
+	}
+	return nil
+}
+
+// fieldType returns the Go type of the output key in the struct of the stack that exports it.
+func fieldType(key string) (reflect.Type, bool) {
+	for _, stack := range []interface{}{VPC{}, Certs{}} {
+		t := reflect.TypeOf(stack)
+		for i := 0; i < t.NumField(); i++ {
+			if name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ","); name == key {
+				return t.Field(i).Type, true
+			}
+		}
+	}
+	return nil, false
+}
+
+func keys(stack interface{}, optional bool) []string {
+	t := reflect.TypeOf(stack)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		name, options, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		if options == "omitempty" && !optional {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,102 @@
+package outputs
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestConstantsMatchStructs makes sure the constants and the struct tags describe the same outputs, so that code
+// using either agrees on the contract.
+func TestConstantsMatchStructs(t *testing.T) {
+	tagged := map[string]bool{}
+	for _, stack := range []interface{}{VPC{}, Certs{}} {
+		for _, key := range Keys(stack) {
+			if tagged[key] {
+				t.Errorf("output %s is declared twice", key)
+			}
+			tagged[key] = true
+		}
+	}
+
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, ".", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	constants := map[string]bool{}
+	for _, file := range pkgs["outputs"].Files {
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.CONST {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				for _, value := range spec.(*ast.ValueSpec).Values {
+					lit, ok := value.(*ast.BasicLit)
+					if !ok || lit.Kind != token.STRING {
+						continue
+					}
+					key, err := strconv.Unquote(lit.Value)
+					if err != nil {
+						t.Fatal(err)
+					}
+					constants[key] = true
+				}
+			}
+		}
+	}
+
+	for key := range constants {
+		if !tagged[key] {
+			t.Errorf("constant %s is not a field of any stack", key)
+		}
+	}
+	for key := range tagged {
+		if !constants[key] {
+			t.Errorf("field %s has no constant", key)
+		}
+	}
+}
+
+func TestRequiredKeys(t *testing.T) {
+	required := map[string]bool{}
+	for _, key := range RequiredKeys(VPC{}) {
+		required[key] = true
+	}
+	if !required[VpcID] || !required[PrivateSubnets] {
+		t.Errorf("required VPC outputs %v are missing the vpc ID or private subnets", required)
+	}
+	if required[DatabaseSubnets] || required[NatInstanceID] {
+		t.Errorf("required VPC outputs %v include optional ones", required)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		key   string
+		value interface{}
+		err   string
+	}{
+		{VpcID, "vpc-0copr", ""},
+		{VpcID, "", "is empty"},
+		{VpcID, nil, "is null"},
+		{PublicSubnets, []interface{}{"subnet-0a", "subnet-0b"}, ""},
+		{PublicSubnets, "subnet-0a", `is "subnet-0a", want a []string`},
+		{PublicSubnetsAZs, map[string]interface{}{"us-east-1a": []interface{}{"subnet-0a"}}, ""},
+		{PublicSubnetsAZs, map[string]interface{}{"us-east-1a": "subnet-0a"}, "want a map[string][]string"},
+		{"vpcID", "vpc-0copr", "not an output"},
+	}
+	for _, tt := range tests {
+		err := Check(tt.key, tt.value)
+		if tt.err == "" && err != nil {
+			t.Errorf("Check(%s, %v) = %v", tt.key, tt.value, err)
+		}
+		if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("Check(%s, %v) = %v, want %q", tt.key, tt.value, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package outputs
+
+// Outputs of the vpc stack
+const (
+	VpcID               = "vpcId"
+	VpcCidrBlock        = "vpcCidrBlock"
+	VpcIpv6CidrBlock    = "vpcIpv6CidrBlock"
+	PublicHostedZoneID  = "publicHostedZoneId"
+	PrivateHostedZoneID = "privateHostedZoneId"
+	PublicDomainName    = "publicDomainName"
+	PrivateDomainName   = "privateDomainName"
+
+	PublicSubnets      = "publicSubnets"
+	PublicSubnetsAZs   = "publicSubnetsAZs"
+	PrivateSubnets     = "privateSubnets"
+	PrivateSubnetsAZs  = "privateSubnetsAZs"
+	DatabaseSubnets    = "databaseSubnets"
+	DatabaseSubnetsAZs = "databaseSubnetsAZs"
+	AvailabilityZones  = "availabilityZones"
+	SubnetAZs          = "subnetAZs"
+
+	PublicSubnetsIpv6CIDRs  = "publicSubnetsIpv6CIDRs"
+	PrivateSubnetsIpv6CIDRs = "privateSubnetsIpv6CIDRs"
+
+	PrivateRouteTableIDs       = "privateRouteTableIds"
+	PeerCidrs                  = "peerCidrs"
+	PeerIpv6Cidrs              = "peerIpv6Cidrs"
+	TransitGatewayAttachmentID = "transitGatewayAttachmentId"
+	VpcPeeringConnectionIDs    = "vpcPeeringConnectionIds"
+	NetworkAclIDs              = "networkAclIds"
+
+	NatStrategy   = "natStrategy"
+	NatGatewayIDs = "natGatewayIds"
+	NatPublicIPs  = "natPublicIps"
+	NatInstanceID = "natInstanceId"
+
+	VpcEndpointIDs             = "vpcEndpointIds"
+	VpcEndpointSecurityGroupID = "vpcEndpointSecurityGroupId"
+
+	FlowLogID              = "flowLogId"
+	FlowLogDestinationType = "flowLogDestinationType"
+	FlowLogDestinationArn  = "flowLogDestinationArn"
+
+	DbSubnetGroupName          = "dbSubnetGroupName"
+	ElastiCacheSubnetGroupName = "elastiCacheSubnetGroupName"
+
+	PublicHostedZoneNameServers = "publicHostedZoneNameServers"
+	PublicZoneDsRecord          = "publicZoneDsRecord"
+
+	DhcpOptionsID      = "dhcpOptionsId"
+	ResolverEndpointID = "resolverEndpointId"
+	ResolverRuleIDs    = "resolverRuleIds"
+)
+
+// VPC are the outputs of the vpc stack.
+type VPC struct {
+	VpcID               string `json:"vpcId"`
+	VpcCidrBlock        string `json:"vpcCidrBlock"`
+	VpcIpv6CidrBlock    string `json:"vpcIpv6CidrBlock,omitempty"`
+	PublicHostedZoneID  string `json:"publicHostedZoneId"`
+	PrivateHostedZoneID string `json:"privateHostedZoneId"`
+	PublicDomainName    string `json:"publicDomainName"`
+	PrivateDomainName   string `json:"privateDomainName"`
+
+	PublicSubnets []string `json:"publicSubnets"`
+	// PublicSubnetsAZs and the other *AZs map each AZ to the subnets of the tier in it
+	PublicSubnetsAZs   map[string][]string `json:"publicSubnetsAZs"`
+	PrivateSubnets     []string            `json:"privateSubnets"`
+	PrivateSubnetsAZs  map[string][]string `json:"privateSubnetsAZs"`
+	DatabaseSubnets    []string            `json:"databaseSubnets,omitempty"`
+	DatabaseSubnetsAZs map[string][]string `json:"databaseSubnetsAZs,omitempty"`
+	AvailabilityZones  []string            `json:"availabilityZones"`
+	// SubnetAZs maps each tier to the AZ of each of its subnets, index for index with the subnet lists
+	SubnetAZs map[string][]string `json:"subnetAZs"`
+
+	PublicSubnetsIpv6CIDRs  []string `json:"publicSubnetsIpv6CIDRs,omitempty"`
+	PrivateSubnetsIpv6CIDRs []string `json:"privateSubnetsIpv6CIDRs,omitempty"`
+
+	PrivateRouteTableIDs       []string          `json:"privateRouteTableIds"`
+	PeerCidrs                  []string          `json:"peerCidrs,omitempty"`
+	PeerIpv6Cidrs              []string          `json:"peerIpv6Cidrs,omitempty"`
+	TransitGatewayAttachmentID string            `json:"transitGatewayAttachmentId,omitempty"`
+	VpcPeeringConnectionIDs    map[string]string `json:"vpcPeeringConnectionIds,omitempty"`
+	NetworkAclIDs              map[string]string `json:"networkAclIds,omitempty"`
+
+	// The NAT outputs are left out when the stack adopts an existing VPC
+	NatStrategy   string   `json:"natStrategy,omitempty"`
+	NatGatewayIDs []string `json:"natGatewayIds,omitempty"`
+	NatPublicIPs  []string `json:"natPublicIps,omitempty"`
+	NatInstanceID string   `json:"natInstanceId,omitempty"`
+
+	VpcEndpointIDs             map[string]string `json:"vpcEndpointIds"`
+	VpcEndpointSecurityGroupID string            `json:"vpcEndpointSecurityGroupId,omitempty"`
+
+	FlowLogID              string `json:"flowLogId,omitempty"`
+	FlowLogDestinationType string `json:"flowLogDestinationType,omitempty"`
+	FlowLogDestinationArn  string `json:"flowLogDestinationArn,omitempty"`
+
+	DbSubnetGroupName          string `json:"dbSubnetGroupName,omitempty"`
+	ElastiCacheSubnetGroupName string `json:"elastiCacheSubnetGroupName,omitempty"`
+
+	PublicHostedZoneNameServers []string `json:"publicHostedZoneNameServers,omitempty"`
+	PublicZoneDsRecord          string   `json:"publicZoneDsRecord,omitempty"`
+
+	DhcpOptionsID      string            `json:"dhcpOptionsId,omitempty"`
+	ResolverEndpointID string            `json:"resolverEndpointId,omitempty"`
+	ResolverRuleIDs    map[string]string `json:"resolverRuleIds,omitempty"`
+}
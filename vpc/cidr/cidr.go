@@ -0,0 +1,143 @@
+// Package cidr carves subnet blocks out of a VPC CIDR and checks hand-written subnet lists against it.
+package cidr
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+)
+
+// TierBits is the number of bits of the VPC prefix reserved to split it into tiers. Each tier (public, private, ...)
+// owns one quarter of the VPC, so growing one tier never renumbers the subnets of another.
+const TierBits = 2
+
+// MaxTiers is the number of tier blocks a VPC CIDR is split into.
+const MaxTiers = 1 << TierBits
+
+// Subnet returns the netNum'th block of base extended by newBits, in the manner of Terraform's cidrsubnet. It
+// works for both IPv4 and IPv6 prefixes.
+func Subnet(base netip.Prefix, newBits, netNum int) (netip.Prefix, error) {
+	base = base.Masked()
+	bits := base.Bits() + newBits
+	if newBits < 0 || bits > base.Addr().BitLen() {
+		return netip.Prefix{}, fmt.Errorf("cannot extend %s by %d bits", base, newBits)
+	}
+	if netNum < 0 || (newBits < 63 && netNum >= 1<<newBits) {
+		return netip.Prefix{}, fmt.Errorf("subnet number %d does not fit in %d bits of %s", netNum, newBits, base)
+	}
+
+	addr := base.Addr().AsSlice()
+	for i := 0; i < newBits; i++ {
+		if netNum&(1<<(newBits-1-i)) == 0 {
+			continue
+		}
+		pos := base.Bits() + i
+		addr[pos/8] |= 0x80 >> (pos % 8)
+	}
+	a, _ := netip.AddrFromSlice(addr)
+	return netip.PrefixFrom(a, bits), nil
+}
+
+// Carve returns count subnets of length prefixLen from the given tier of vpcCIDR. Tier numbers run from 0 to
+// MaxTiers-1.
+func Carve(vpcCIDR string, prefixLen, tier, count int) ([]string, error) {
+	vpc, err := netip.ParsePrefix(vpcCIDR)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VPC CIDR %q: %w", vpcCIDR, err)
+	}
+	if tier < 0 || tier >= MaxTiers {
+		return nil, fmt.Errorf("tier %d is out of range, expected 0-%d", tier, MaxTiers-1)
+	}
+	if prefixLen < vpc.Bits()+TierBits {
+		return nil, fmt.Errorf("subnet prefix /%d is too large to carve %d tiers out of %s, use /%d or smaller",
+			prefixLen, MaxTiers, vpcCIDR, vpc.Bits()+TierBits)
+	}
+
+	block, err := Subnet(vpc, TierBits, tier)
+	if err != nil {
+		return nil, err
+	}
+
+	newBits := prefixLen - block.Bits()
+	if newBits < 63 && count > 1<<newBits {
+		return nil, fmt.Errorf("cannot fit %d /%d subnets in tier %d (%s) of %s", count, prefixLen, tier, block, vpcCIDR)
+	}
+
+	subnets := make([]string, count)
+	for i := range subnets {
+		subnet, err := Subnet(block, newBits, i)
+		if err != nil {
+			return nil, err
+		}
+		subnets[i] = subnet.String()
+	}
+	return subnets, nil
+}
+
+// Validate checks that every subnet is a well-formed CIDR inside vpcCIDR and that no two subnets overlap. All
+// problems are reported together.
+func Validate(vpcCIDR string, subnets []string) error {
+	vpc, err := netip.ParsePrefix(vpcCIDR)
+	if err != nil {
+		return fmt.Errorf("invalid VPC CIDR %q: %w", vpcCIDR, err)
+	}
+
+	var errs []error
+	parsed := make([]netip.Prefix, 0, len(subnets))
+	for _, s := range subnets {
+		subnet, err := netip.ParsePrefix(s)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid subnet CIDR %q: %w", s, err))
+			continue
+		}
+		if subnet.Masked() != subnet {
+			errs = append(errs, fmt.Errorf("subnet %s has host bits set, did you mean %s?", s, subnet.Masked()))
+		}
+		if subnet.Bits() < vpc.Bits() || !vpc.Contains(subnet.Addr()) {
+			errs = append(errs, fmt.Errorf("subnet %s is not inside the VPC CIDR %s", s, vpcCIDR))
+		}
+		for _, other := range parsed {
+			if subnet.Overlaps(other) {
+				errs = append(errs, fmt.Errorf("subnet %s overlaps subnet %s", s, other))
+			}
+		}
+		parsed = append(parsed, subnet)
+	}
+	return errors.Join(errs...)
+}
+
+// ValidatePeers checks the CIDRs of networks routed to from the VPC: each must be well-formed and may neither
+// overlap the VPC CIDR nor another peer's. vpcCIDR may be empty when it is not known yet. All problems are reported
+// together.
+func ValidatePeers(vpcCIDR string, peers []string) error {
+	var vpc netip.Prefix
+	if vpcCIDR != "" {
+		var err error
+		if vpc, err = netip.ParsePrefix(vpcCIDR); err != nil {
+			return fmt.Errorf("invalid VPC CIDR %q: %w", vpcCIDR, err)
+		}
+	}
+
+	var errs []error
+	parsed := make([]netip.Prefix, 0, len(peers))
+	for _, p := range peers {
+		peer, err := netip.ParsePrefix(p)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid peer CIDR %q: %w", p, err))
+			continue
+		}
+		if peer.Masked() != peer {
+			errs = append(errs, fmt.Errorf("peer CIDR %s has host bits set, did you mean %s?", p, peer.Masked()))
+		}
+		if vpc.IsValid() && peer.Overlaps(vpc) {
+			errs = append(errs, fmt.Errorf("peer CIDR %s overlaps the VPC CIDR %s", p, vpcCIDR))
+		}
+		for _, other := range parsed {
+			if peer.Overlaps(other) {
+				errs = append(errs, fmt.Errorf("peer CIDR %s overlaps peer CIDR %s", p, other))
+			}
+		}
+		parsed = append(parsed, peer)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,236 @@
+package cidr
+
+import (
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSubnet(t *testing.T) {
+	tests := []struct {
+		name    string
+		base    string
+		newBits int
+		netNum  int
+		want    string
+		wantErr bool
+	}{
+		{"first /24 of a /16", "10.0.0.0/16", 8, 0, "10.0.0.0/24", false},
+		{"last /24 of a /16", "10.0.0.0/16", 8, 255, "10.0.255.0/24", false},
+		{"unaligned bits", "10.0.0.0/16", 3, 5, "10.0.160.0/19", false},
+		{"host bits in base are ignored", "10.0.12.1/16", 8, 1, "10.0.1.0/24", false},
+		{"zero new bits", "192.168.0.0/24", 0, 0, "192.168.0.0/24", false},
+		{"ipv6 /64 of a /56", "2600:1f18:abc:de00::/56", 8, 0x2a, "2600:1f18:abc:de2a::/64", false},
+		{"netNum too large", "10.0.0.0/16", 2, 4, "", true},
+		{"negative netNum", "10.0.0.0/16", 2, -1, "", true},
+		{"past the address length", "10.0.0.0/30", 4, 0, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Subnet(netip.MustParsePrefix(tt.base), tt.newBits, tt.netNum)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Subnet() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got.String() != tt.want {
+				t.Errorf("Subnet() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCarve(t *testing.T) {
+	tests := []struct {
+		name      string
+		vpc       string
+		prefixLen int
+		tier      int
+		count     int
+		want      []string
+		wantErr   string
+	}{
+		{
+			name: "public tier", vpc: "10.0.0.0/16", prefixLen: 24, tier: 0, count: 3,
+			want: []string{"10.0.0.0/24", "10.0.1.0/24", "10.0.2.0/24"},
+		},
+		{
+			name: "private tier", vpc: "10.0.0.0/16", prefixLen: 24, tier: 1, count: 3,
+			want: []string{"10.0.64.0/24", "10.0.65.0/24", "10.0.66.0/24"},
+		},
+		{
+			name: "whole tier", vpc: "10.0.0.0/16", prefixLen: 18, tier: 3, count: 1,
+			want: []string{"10.0.192.0/18"},
+		},
+		{
+			name: "zero subnets", vpc: "10.0.0.0/16", prefixLen: 24, tier: 0, count: 0,
+			want: []string{},
+		},
+		{name: "prefix too large", vpc: "10.0.0.0/16", prefixLen: 17, tier: 0, count: 1, wantErr: "too large"},
+		{name: "too many subnets", vpc: "10.0.0.0/16", prefixLen: 19, tier: 0, count: 3, wantErr: "cannot fit"},
+		{name: "tier out of range", vpc: "10.0.0.0/16", prefixLen: 24, tier: MaxTiers, count: 1, wantErr: "out of range"},
+		{name: "bad VPC CIDR", vpc: "10.0.0.0", prefixLen: 24, tier: 0, count: 1, wantErr: "invalid VPC CIDR"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Carve(tt.vpc, tt.prefixLen, tt.tier, tt.count)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Carve() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Carve() unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Carve() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCarvedTiersDoNotOverlap(t *testing.T) {
+	var all []string
+	for tier := 0; tier < MaxTiers; tier++ {
+		subnets, err := Carve("172.16.0.0/20", 24, tier, 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		all = append(all, subnets...)
+	}
+	if err := Validate("172.16.0.0/20", all); err != nil {
+		t.Errorf("carved subnets failed validation: %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		vpc     string
+		subnets []string
+		wantErr []string
+	}{
+		{
+			name:    "valid",
+			vpc:     "10.0.0.0/16",
+			subnets: []string{"10.0.0.0/24", "10.0.1.0/24", "10.0.128.0/20"},
+		},
+		{
+			name:    "outside the VPC",
+			vpc:     "10.0.0.0/16",
+			subnets: []string{"10.1.0.0/24"},
+			wantErr: []string{"10.1.0.0/24 is not inside the VPC CIDR 10.0.0.0/16"},
+		},
+		{
+			name:    "larger than the VPC",
+			vpc:     "10.0.0.0/16",
+			subnets: []string{"10.0.0.0/8"},
+			wantErr: []string{"10.0.0.0/8 is not inside"},
+		},
+		{
+			name:    "overlap",
+			vpc:     "10.0.0.0/16",
+			subnets: []string{"10.0.0.0/23", "10.0.1.0/24"},
+			wantErr: []string{"10.0.1.0/24 overlaps subnet 10.0.0.0/23"},
+		},
+		{
+			name:    "host bits",
+			vpc:     "10.0.0.0/16",
+			subnets: []string{"10.0.0.1/24"},
+			wantErr: []string{"did you mean 10.0.0.0/24"},
+		},
+		{
+			name:    "every problem is reported",
+			vpc:     "10.0.0.0/16",
+			subnets: []string{"bogus", "10.2.0.0/24", "10.0.0.0/24", "10.0.0.0/25"},
+			wantErr: []string{`invalid subnet CIDR "bogus"`, "10.2.0.0/24 is not inside", "10.0.0.0/25 overlaps"},
+		},
+		{
+			name:    "bad VPC CIDR",
+			vpc:     "nope",
+			subnets: []string{"10.0.0.0/24"},
+			wantErr: []string{"invalid VPC CIDR"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.vpc, tt.subnets)
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Fatalf("Validate() unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate() = nil, want errors %q", tt.wantErr)
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate() error %q does not mention %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidatePeers(t *testing.T) {
+	tests := []struct {
+		name    string
+		vpc     string
+		peers   []string
+		wantErr []string
+	}{
+		{
+			name:  "valid",
+			vpc:   "10.0.0.0/16",
+			peers: []string{"10.20.0.0/16", "10.30.0.0/16", "fd00:30::/56"},
+		},
+		{
+			name:    "overlaps the VPC",
+			vpc:     "10.0.0.0/16",
+			peers:   []string{"10.0.128.0/20"},
+			wantErr: []string{"10.0.128.0/20 overlaps the VPC CIDR 10.0.0.0/16"},
+		},
+		{
+			name:    "VPC inside a peer",
+			vpc:     "10.0.0.0/16",
+			peers:   []string{"10.0.0.0/8"},
+			wantErr: []string{"10.0.0.0/8 overlaps the VPC CIDR"},
+		},
+		{
+			name:    "overlapping peers",
+			vpc:     "10.0.0.0/16",
+			peers:   []string{"10.20.0.0/16", "10.20.4.0/24", "fd00:30::/56", "fd00:30::/64"},
+			wantErr: []string{"10.20.4.0/24 overlaps peer CIDR 10.20.0.0/16", "fd00:30::/64 overlaps peer CIDR fd00:30::/56"},
+		},
+		{
+			name:  "VPC CIDR not known yet",
+			peers: []string{"10.0.0.0/16"},
+		},
+		{
+			name:    "every problem is reported",
+			vpc:     "10.0.0.0/16",
+			peers:   []string{"bogus", "10.20.0.1/16", "10.0.1.0/24"},
+			wantErr: []string{`invalid peer CIDR "bogus"`, "did you mean 10.20.0.0/16", "10.0.1.0/24 overlaps the VPC"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidatePeers(tt.vpc, tt.peers)
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Fatalf("ValidatePeers() unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("ValidatePeers() = nil, want errors %q", tt.wantErr)
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("ValidatePeers() error %q does not mention %q", err, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package network
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ec2"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// adoptVpc looks up a VPC that is managed outside of this stack, along with its subnets and the route tables of its
+// private subnets. Nothing here is created, so destroying the stack leaves the VPC alone.
+//
+// Each tier's subnets come from its subnet IDs if set, else from the subnets carrying all of its subnet tags.
+// Failing both, subnets that map public IPs on launch are public and the rest private; the database tier is only
+// adopted when asked for.
+func adoptVpc(ctx *pulumi.Context, args *ExistingVpcArgs) (*vpcNetwork, error) {
+	vpcID := args.VpcID
+	vpc, err := ec2.LookupVpc(ctx, &ec2.LookupVpcArgs{
+		Id: pulumi.StringRef(vpcID),
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("looking up existing VPC %s: %w", vpcID, err)
+	}
+
+	network := &vpcNetwork{
+		VpcID:         pulumi.String(vpc.Id).ToStringOutput(),
+		CidrBlock:     pulumi.String(vpc.CidrBlock).ToStringOutput(),
+		Ipv6:          vpc.Ipv6CidrBlock != "",
+		Ipv6CidrBlock: pulumi.String(vpc.Ipv6CidrBlock).ToStringOutput(),
+	}
+
+	// A subnet belongs to at most one tier. Database subnets are claimed first so that the public IP heuristic
+	// does not sweep them into the private tier.
+	claimed := map[string]bool{}
+	privateRouteTables := map[string]bool{}
+	for _, tier := range []struct {
+		name     string
+		ids      []string
+		tags     map[string]string
+		subnets  *[]subnetRef
+		fallback *bool
+	}{
+		{"database", args.DatabaseSubnetIDs, args.DatabaseSubnetTags, &network.DatabaseSubnets, nil},
+		{"public", args.PublicSubnetIDs, args.PublicSubnetTags, &network.PublicSubnets, pulumi.BoolRef(true)},
+		{"private", args.PrivateSubnetIDs, args.PrivateSubnetTags, &network.PrivateSubnets, pulumi.BoolRef(false)},
+	} {
+		ids, err := existingSubnetIDs(ctx, vpcID, tier.name, tier.ids, tier.tags, tier.fallback)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			if claimed[id] {
+				continue
+			}
+			claimed[id] = true
+
+			subnet, err := ec2.LookupSubnet(ctx, &ec2.LookupSubnetArgs{
+				Id: pulumi.StringRef(id),
+			}, nil)
+			if err != nil {
+				return nil, fmt.Errorf("looking up existing subnet %s: %w", id, err)
+			}
+			if subnet.VpcId != vpcID {
+				return nil, fmt.Errorf("subnet %s belongs to %s, not to the adopted VPC %s", id, subnet.VpcId, vpcID)
+			}
+			*tier.subnets = append(*tier.subnets, subnetRef{
+				ID:            pulumi.String(subnet.Id).ToStringOutput(),
+				AZ:            subnet.AvailabilityZone,
+				Ipv6CidrBlock: pulumi.String(subnet.Ipv6CidrBlock).ToStringOutput(),
+			})
+
+			if tier.subnets == &network.PrivateSubnets {
+				rtID, err := subnetRouteTableID(ctx, vpcID, id)
+				if err != nil {
+					return nil, err
+				}
+				if !privateRouteTables[rtID] {
+					privateRouteTables[rtID] = true
+					network.PrivateRouteTableIDs = append(network.PrivateRouteTableIDs, pulumi.String(rtID))
+				}
+			}
+		}
+	}
+
+	if len(network.PublicSubnets) == 0 {
+		return nil, fmt.Errorf("found no public subnets in the adopted VPC %s", vpcID)
+	}
+
+	azs := map[string]bool{}
+	for _, subnets := range [][]subnetRef{network.PublicSubnets, network.PrivateSubnets, network.DatabaseSubnets} {
+		for _, subnet := range subnets {
+			if !azs[subnet.AZ] {
+				azs[subnet.AZ] = true
+				network.AvailabilityZones = append(network.AvailabilityZones, subnet.AZ)
+			}
+		}
+	}
+	sort.Strings(network.AvailabilityZones)
+
+	return network, nil
+}
+
+// existingSubnetIDs returns the sorted IDs of the adopted subnets of one tier. When neither IDs nor tags are
+// configured for the tier, mapPublicIP (if set) selects the subnets by their map-public-ip-on-launch attribute.
+func existingSubnetIDs(
+	ctx *pulumi.Context,
+	vpcID, tier string,
+	ids []string,
+	tags map[string]string,
+	mapPublicIP *bool,
+) ([]string, error) {
+	if len(ids) > 0 {
+		return ids, nil
+	}
+
+	filters := []ec2.GetSubnetsFilter{
+		{
+			Name:   "vpc-id",
+			Values: []string{vpcID},
+		},
+	}
+	if len(tags) == 0 {
+		if mapPublicIP == nil {
+			return nil, nil
+		}
+		filters = append(filters, ec2.GetSubnetsFilter{
+			Name:   "map-public-ip-on-launch",
+			Values: []string{fmt.Sprint(*mapPublicIP)},
+		})
+	}
+
+	subnets, err := ec2.GetSubnets(ctx, &ec2.GetSubnetsArgs{
+		Filters: filters,
+		Tags:    tags,
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("looking up %s subnets of the adopted VPC %s: %w", tier, vpcID, err)
+	}
+
+	// Keep the order, and with it the exported subnet lists, stable across runs
+	ids = append(ids, subnets.Ids...)
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// subnetRouteTableID returns the route table a subnet is explicitly associated with, or the VPC's main route table
+// for subnets that have no association of their own. The association is searched for rather than looked up, so
+// that finding none is told apart from failing to look, which is an error.
+func subnetRouteTableID(ctx *pulumi.Context, vpcID, subnetID string) (string, error) {
+	associated, err := ec2.GetRouteTables(ctx, &ec2.GetRouteTablesArgs{
+		VpcId: pulumi.StringRef(vpcID),
+		Filters: []ec2.GetRouteTablesFilter{
+			{
+				Name:   "association.subnet-id",
+				Values: []string{subnetID},
+			},
+		},
+	}, nil)
+	if err != nil {
+		return "", fmt.Errorf("looking up the route table of subnet %s: %w", subnetID, err)
+	}
+	if len(associated.Ids) > 0 {
+		return associated.Ids[0], nil
+	}
+
+	rt, err := ec2.LookupRouteTable(ctx, &ec2.LookupRouteTableArgs{
+		VpcId: pulumi.StringRef(vpcID),
+		Filters: []ec2.GetRouteTableFilter{
+			{
+				Name:   "association.main",
+				Values: []string{"true"},
+			},
+		},
+	}, nil)
+	if err != nil {
+		return "", fmt.Errorf("looking up the main route table of the adopted VPC %s: %w", vpcID, err)
+	}
+	return rt.RouteTableId, nil
+}
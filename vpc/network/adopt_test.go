@@ -0,0 +1,170 @@
+package network
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"copr-pulumi-go-aws-outputs"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// adoptMocks answers the lookups of an adopted VPC: two public and two private subnets, the second private one
+// without a route table of its own, and two database subnets that do not map public IPs either. Looking up the
+// route table of failSubnet fails.
+type adoptMocks struct {
+	*mocks
+	failSubnet string
+}
+
+var adoptedSubnetAZs = map[string]string{
+	"subnet-0pub-a":  "us-east-1a",
+	"subnet-0pub-b":  "us-east-1b",
+	"subnet-0priv-a": "us-east-1a",
+	"subnet-0priv-b": "us-east-1b",
+	"subnet-0db-a":   "us-east-1a",
+	"subnet-0db-b":   "us-east-1b",
+}
+
+func (m *adoptMocks) Call(args pulumi.MockCallArgs) (resource.PropertyMap, error) {
+	outputs := args.Args.Copy()
+	filter := func(name string) string {
+		for _, f := range args.Args["filters"].ArrayValue() {
+			if f.ObjectValue()["name"].StringValue() == name {
+				return f.ObjectValue()["values"].ArrayValue()[0].StringValue()
+			}
+		}
+		return ""
+	}
+	ids := func(ids ...string) resource.PropertyValue {
+		values := make([]interface{}, len(ids))
+		for i, id := range ids {
+			values[i] = id
+		}
+		return resource.NewPropertyValue(values)
+	}
+
+	switch args.Token {
+	case "aws:ec2/getVpc:getVpc":
+		outputs["cidrBlock"] = resource.NewStringProperty("10.1.0.0/16")
+	case "aws:ec2/getSubnets:getSubnets":
+		switch {
+		case args.Args.HasValue("tags"):
+			outputs["ids"] = ids("subnet-0db-b", "subnet-0db-a")
+		case filter("map-public-ip-on-launch") == "true":
+			outputs["ids"] = ids("subnet-0pub-b", "subnet-0pub-a")
+		default:
+			outputs["ids"] = ids("subnet-0priv-b", "subnet-0db-a", "subnet-0priv-a", "subnet-0db-b")
+		}
+	case "aws:ec2/getSubnet:getSubnet":
+		outputs["vpcId"] = resource.NewStringProperty("vpc-0adopted")
+		outputs["availabilityZone"] = resource.NewStringProperty(adoptedSubnetAZs[args.Args["id"].StringValue()])
+	case "aws:ec2/getRouteTables:getRouteTables":
+		switch subnet := filter("association.subnet-id"); subnet {
+		case m.failSubnet:
+			return nil, fmt.Errorf("RequestLimitExceeded: Request limit exceeded")
+		case "subnet-0priv-a":
+			outputs["ids"] = ids("rtb-0private-a")
+		default:
+			outputs["ids"] = ids()
+		}
+	case "aws:ec2/getRouteTable:getRouteTable":
+		outputs["routeTableId"] = resource.NewStringProperty("rtb-0main")
+	default:
+		return m.mocks.Call(args)
+	}
+	return outputs, nil
+}
+
+func adoptArgs() *VpcArgs {
+	args := testArgs()
+	args.CidrBlock = ""
+	args.Subnets = SubnetArgs{}
+	args.Existing = &ExistingVpcArgs{
+		VpcID:              "vpc-0adopted",
+		DatabaseSubnetTags: map[string]string{"tier": "database"},
+	}
+	return args
+}
+
+func TestAdoptVpc(t *testing.T) {
+	m := &adoptMocks{mocks: &mocks{}}
+	exported := map[string]interface{}{}
+	// The outputs of an adopted VPC are mostly known up front, and applies on those are not waited for by the run
+	done := make(chan struct{})
+	err := pulumi.RunErr(func(ctx *pulumi.Context) error {
+		vpc, err := NewVpc(ctx, "test-network", adoptArgs())
+		if err != nil {
+			return err
+		}
+		var keys []string
+		var values []interface{}
+		for key, value := range vpc.StackOutputs() {
+			keys = append(keys, key)
+			values = append(values, value)
+		}
+		pulumi.All(values...).ApplyT(func(values []interface{}) error {
+			for i, key := range keys {
+				exported[key] = values[i]
+			}
+			close(done)
+			return nil
+		})
+		return nil
+	}, pulumi.WithMocks("copr-pulumi-go-aws-vpc", "test", m))
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the stack outputs were never resolved")
+	}
+
+	// Subnets are sorted by ID, the database subnets only land in their own tier, and the private subnet without
+	// an association of its own uses the main route table
+	for key, want := range map[string]interface{}{
+		outputs.VpcID:                "vpc-0adopted",
+		outputs.VpcCidrBlock:         "10.1.0.0/16",
+		outputs.PublicSubnets:        []string{"subnet-0pub-a", "subnet-0pub-b"},
+		outputs.PrivateSubnets:       []string{"subnet-0priv-a", "subnet-0priv-b"},
+		outputs.DatabaseSubnets:      []string{"subnet-0db-a", "subnet-0db-b"},
+		outputs.PrivateRouteTableIDs: []string{"rtb-0private-a", "rtb-0main"},
+		outputs.AvailabilityZones:    []string{"us-east-1a", "us-east-1b"},
+		outputs.PublicSubnetsAZs: map[string][]string{
+			"us-east-1a": {"subnet-0pub-a"},
+			"us-east-1b": {"subnet-0pub-b"},
+		},
+	} {
+		if got, ok := exported[key]; !ok {
+			t.Errorf("stack outputs are missing %s", key)
+		} else if !reflect.DeepEqual(got, want) {
+			t.Errorf("stack output %s = %v, want %v", key, got, want)
+		}
+	}
+	// Nothing about the adopted VPC's gateways is known
+	for _, key := range []string{outputs.NatStrategy, outputs.NatGatewayIDs, outputs.DhcpOptionsID} {
+		if _, ok := exported[key]; ok {
+			t.Errorf("stack outputs have %s for an adopted VPC", key)
+		}
+	}
+	if got := m.count("aws:ec2/subnet:Subnet") + m.count("aws:ec2/vpc:Vpc"); got != 0 {
+		t.Errorf("created %d VPCs and subnets for an adopted VPC", got)
+	}
+}
+
+func TestAdoptVpcRouteTableLookupFails(t *testing.T) {
+	m := &adoptMocks{mocks: &mocks{}, failSubnet: "subnet-0priv-b"}
+	var err error
+	_ = pulumi.RunErr(func(ctx *pulumi.Context) error {
+		_, err = NewVpc(ctx, "test-network", adoptArgs())
+		return err
+	}, pulumi.WithMocks("copr-pulumi-go-aws-vpc", "test", m))
+	if err == nil || !strings.Contains(err.Error(), "route table of subnet subnet-0priv-b") {
+		t.Fatalf("NewVpc() error = %v, want the failed route table lookup", err)
+	}
+}
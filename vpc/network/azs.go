@@ -0,0 +1,97 @@
+package network
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// resolveAvailabilityZones returns the AZs that subnets are spread over, in the order that subnet indexes map onto
+// them (see subnetAz). The candidates are the region's available AZs minus the excluded ones. With an allow-list
+// those AZs are used in the order given; otherwise the candidates are sorted by name. Either way the list is then
+// cut down to args.Max, which may not ask for more AZs than there are.
+//
+// Without an allow-list or a maximum the stack keeps the placement it had before AZs could be selected: every AZ
+// of the region, back to front. Moving existing subnets to other AZs would replace them, and their replacements
+// would clash with the CIDRs they still hold. That placement shifts whenever AWS opens an AZ, so it is only kept
+// for stacks that have not chosen their AZs yet.
+func resolveAvailabilityZones(ctx *pulumi.Context, args AvailabilityZoneArgs) ([]string, error) {
+	allowed, excluded := args.Allow, args.Exclude
+
+	if len(allowed) == 0 && args.Max == 0 {
+		// Like before, every AZ the region reports whatever its state
+		azs, err := aws.GetAvailabilityZones(ctx, &aws.GetAvailabilityZonesArgs{
+			ExcludeNames: excluded,
+		}, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(azs.Names) == 0 {
+			return nil, fmt.Errorf("no availability zones are left to place subnets in")
+		}
+		names := make([]string, len(azs.Names))
+		for i, name := range azs.Names {
+			names[len(names)-1-i] = name
+		}
+		ctx.Log.Warn(fmt.Sprintf("Subnets are placed on all AZs of the region back to front, which changes when AWS "+
+			"adds an AZ. Set availabilityZones to %v to keep them where they are.", names), nil)
+		return names, nil
+	}
+
+	available, err := aws.GetAvailabilityZones(ctx, &aws.GetAvailabilityZonesArgs{
+		State:        pulumi.StringRef("available"),
+		ExcludeNames: excluded,
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	if len(allowed) > 0 {
+		isAvailable := make(map[string]bool, len(available.Names))
+		for _, name := range available.Names {
+			isAvailable[name] = true
+		}
+		for _, name := range allowed {
+			if !isAvailable[name] {
+				return nil, fmt.Errorf("availability zone %s is excluded or not available in this region", name)
+			}
+			names = append(names, name)
+		}
+	} else {
+		names = append(names, available.Names...)
+		sort.Strings(names)
+	}
+
+	if args.Max > len(names) {
+		return nil, fmt.Errorf("subnets should be spread over %d availability zones, but only %d are left: %v",
+			args.Max, len(names), names)
+	}
+	if args.Max > 0 {
+		names = names[:args.Max]
+	}
+
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no availability zones are left to place subnets in")
+	}
+	return names, nil
+}
+
+// subnetAz returns the AZ that the index'th subnet of a tier is placed in. Subnets go round-robin over the AZs, so
+// a tier with more subnets than AZs ends up with several subnets per AZ.
+func subnetAz(azNames []string, index int) string {
+	return azNames[index%len(azNames)]
+}
+
+// subnetResourceName names a per-subnet resource of a tier, where kind is e.g. "public-subnet" or "private-rta".
+// The first subnet in an AZ keeps the plain <kind>-<az> name, further subnets in the same AZ get a -2, -3, ...
+// suffix. Like subnetAz, the name only depends on the subnet's index, so it is stable as a tier grows.
+func subnetResourceName(resPrefix, kind string, azNames []string, index int) string {
+	az := subnetAz(azNames, index)
+	if nth := index / len(azNames); nth > 0 {
+		return fmt.Sprintf("%s%s-%s-%d", resPrefix, kind, az, nth+1)
+	}
+	return fmt.Sprintf("%s%s-%s", resPrefix, kind, az)
+}
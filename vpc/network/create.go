@@ -0,0 +1,442 @@
+package network
+
+import (
+	"copr-pulumi-go-aws-vpc/cidr"
+	"fmt"
+	"net/netip"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ec2"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// createVpc builds the VPC from scratch: the VPC itself, its internet and NAT gateways, the public, private and
+// database subnets and their route tables, and any transit gateway or peering connections to other networks.
+func createVpc(ctx *pulumi.Context, v *Vpc, args *VpcArgs, opts ...pulumi.ResourceOption) (*vpcNetwork, error) {
+	resPrefix := args.ResourcePrefix
+	VPCCIDR := args.CidrBlock
+	enableIpv6 := args.EnableIpv6
+
+	vpcArgs := &ec2.VpcArgs{
+		AssignGeneratedIpv6CidrBlock: pulumi.Bool(enableIpv6),
+		EnableDnsSupport:             pulumi.Bool(true),
+		EnableDnsHostnames:           pulumi.Bool(true),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(resPrefix + "vpc"),
+		},
+	}
+	switch {
+	case args.Ipam != nil && VPCCIDR != "":
+		return nil, fmt.Errorf("a VPC takes its CIDR either from CidrBlock or from an IPAM pool, not both")
+	case args.Ipam != nil:
+		if args.Ipam.PoolID == "" || args.Ipam.NetmaskLength == 0 {
+			return nil, fmt.Errorf("an IPAM allocated VPC needs a pool ID and a netmask length")
+		}
+		if args.Subnets.PrefixLength == 0 {
+			return nil, fmt.Errorf("the subnets of an IPAM allocated VPC have to be carved, set a subnet prefix length")
+		}
+		vpcArgs.Ipv4IpamPoolId = pulumi.String(args.Ipam.PoolID)
+		vpcArgs.Ipv4NetmaskLength = pulumi.Int(args.Ipam.NetmaskLength)
+
+		// The CIDR is only known once IPAM has allocated it. Carving only depends on the sizes involved, so lay
+		// the subnets out on a stand-in of the same size to catch mistakes now; see subnetCidr.
+		VPCCIDR = fmt.Sprintf("0.0.0.0/%d", args.Ipam.NetmaskLength)
+	case VPCCIDR != "":
+		vpcArgs.CidrBlock = pulumi.String(VPCCIDR)
+	default:
+		return nil, fmt.Errorf("a CidrBlock or an IPAM pool is needed to create a VPC")
+	}
+
+	natStrategy, err := checkNatStrategy(args.Nat.Strategy)
+	if err != nil {
+		return nil, err
+	}
+
+	azNames, err := resolveAvailabilityZones(ctx, args.AvailabilityZones)
+	if err != nil {
+		return nil, err
+	}
+
+	publicSubnetCidrBlocks, privateSubnetCidrBlocks, databaseSubnetCidrBlocks, err := subnetCidrBlocks(args.Subnets, VPCCIDR, len(azNames))
+	if err != nil {
+		return nil, err
+	}
+	if enableIpv6 {
+		for _, tier := range []struct {
+			name   string
+			blocks []string
+		}{
+			{"public", publicSubnetCidrBlocks},
+			{"private", privateSubnetCidrBlocks},
+			{"database", databaseSubnetCidrBlocks},
+		} {
+			if len(tier.blocks) > maxIpv6SubnetsPerTier {
+				return nil, fmt.Errorf("the %s tier has %d subnets, but only %d IPv6 /64s fit in its quarter of the VPC's /56",
+					tier.name, len(tier.blocks), maxIpv6SubnetsPerTier)
+			}
+		}
+	}
+	// An IPAM allocated CIDR is not known yet, only its stand-in
+	if err = checkPeerCidrs(args, args.CidrBlock); err != nil {
+		return nil, err
+	}
+
+	vpc, err := ec2.NewVpc(ctx, resPrefix+"vpc", vpcArgs, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if !args.KeepVpcDefaults {
+		if err = restrictVpcDefaults(ctx, args, vpc, opts...); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = createDhcpOptions(ctx, v, args, vpc, opts...); err != nil {
+		return nil, err
+	}
+
+	internetGateway, err := ec2.NewInternetGateway(ctx, resPrefix+"igw", &ec2.InternetGatewayArgs{
+		VpcId: vpc.ID(),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(resPrefix + "igw"),
+		},
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	publicRoutes := ec2.RouteTableRouteArray{
+		&ec2.RouteTableRouteArgs{
+			CidrBlock: pulumi.String("0.0.0.0/0"),
+			GatewayId: internetGateway.ID(),
+		},
+	}
+
+	// Private subnets reach the IPv6 internet through an egress-only gateway, the IPv6 analogue of a NAT
+	// gateway. Public subnets use the internet gateway for both address families.
+	var egressOnlyGateway *ec2.EgressOnlyInternetGateway
+	if enableIpv6 {
+		egressOnlyGateway, err = ec2.NewEgressOnlyInternetGateway(ctx, resPrefix+"eigw", &ec2.EgressOnlyInternetGatewayArgs{
+			VpcId: vpc.ID(),
+			Tags: pulumi.StringMap{
+				"Name": pulumi.String(resPrefix + "eigw"),
+			},
+		}, opts...)
+		if err != nil {
+			return nil, err
+		}
+
+		publicRoutes = append(publicRoutes, &ec2.RouteTableRouteArgs{
+			Ipv6CidrBlock: pulumi.String("::/0"),
+			GatewayId:     internetGateway.ID(),
+		})
+	}
+
+	privateSubnets := make([]*ec2.Subnet, len(privateSubnetCidrBlocks))
+	privateSubnetRefs := make([]subnetRef, len(privateSubnetCidrBlocks))
+	for i := range privateSubnetCidrBlocks {
+		az := subnetAz(azNames, i)
+
+		prSN := subnetResourceName(resPrefix, "private-subnet", azNames, i)
+		privateSubnetArgs := &ec2.SubnetArgs{
+			VpcId:            vpc.ID(),
+			CidrBlock:        subnetCidr(vpc, args, privateSubnetCidrBlocks, privateTier, i),
+			AvailabilityZone: pulumi.String(az),
+			Tags: pulumi.StringMap{
+				"Name": pulumi.String(prSN),
+			},
+		}
+		if enableIpv6 {
+			privateSubnetArgs.Ipv6CidrBlock = ipv6SubnetCidr(vpc, privateTier, i)
+			privateSubnetArgs.AssignIpv6AddressOnCreation = pulumi.Bool(true)
+		}
+		privateSubnet, err := ec2.NewSubnet(ctx, prSN, privateSubnetArgs, opts...)
+		if err != nil {
+			return nil, err
+		}
+
+		privateSubnets[i] = privateSubnet
+		privateSubnetRefs[i] = newSubnetRef(privateSubnet, az)
+	}
+
+	// Routes to other networks go into both the public and the private route tables
+	peerRoutes, err := createPeerConnections(ctx, v, args, vpc, privateSubnetRefs, opts...)
+	if err != nil {
+		return nil, err
+	}
+	publicRoutes = append(publicRoutes, peerRoutes...)
+
+	routeTable, err := ec2.NewRouteTable(ctx, resPrefix+"public-rt", &ec2.RouteTableArgs{
+		VpcId:  vpc.ID(),
+		Routes: publicRoutes,
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	publicSubnets := make([]*ec2.Subnet, len(publicSubnetCidrBlocks))
+	publicSubnetRefs := make([]subnetRef, len(publicSubnetCidrBlocks))
+	natGateways := make(map[string]*ec2.NatGateway, len(publicSubnetCidrBlocks))
+	privateRouteTables := make(map[string]*ec2.RouteTable, len(privateSubnetCidrBlocks))
+	var natGatewayList []*ec2.NatGateway
+	var privateRouteTableList []*ec2.RouteTable
+
+	for i := range publicSubnetCidrBlocks {
+		az := subnetAz(azNames, i)
+
+		pSN := subnetResourceName(resPrefix, "public-subnet", azNames, i)
+		publicSubnetArgs := &ec2.SubnetArgs{
+			VpcId:               vpc.ID(),
+			CidrBlock:           subnetCidr(vpc, args, publicSubnetCidrBlocks, publicTier, i),
+			AvailabilityZone:    pulumi.String(az),
+			MapPublicIpOnLaunch: pulumi.Bool(true),
+			Tags: pulumi.StringMap{
+				"Name": pulumi.String(pSN),
+			},
+		}
+		if enableIpv6 {
+			publicSubnetArgs.Ipv6CidrBlock = ipv6SubnetCidr(vpc, publicTier, i)
+			publicSubnetArgs.AssignIpv6AddressOnCreation = pulumi.Bool(true)
+		}
+		publicSubnet, err := ec2.NewSubnet(ctx, pSN, publicSubnetArgs, opts...)
+		if err != nil {
+			return nil, err
+		}
+
+		pRTAN := subnetResourceName(resPrefix, "public-rta", azNames, i)
+		_, err = ec2.NewRouteTableAssociation(ctx, pRTAN, &ec2.RouteTableAssociationArgs{
+			SubnetId:     publicSubnet.ID(),
+			RouteTableId: routeTable.ID(),
+		}, opts...)
+		if err != nil {
+			return nil, err
+		}
+
+		// perAz builds a gateway in every AZ with a public subnet, single only in the first one.
+		if natGateways[az] == nil && (natStrategy == NatStrategyPerAz || natStrategy == NatStrategySingle && len(natGateways) == 0) {
+			eip, err := ec2.NewEip(ctx, fmt.Sprintf("%seip-%s", resPrefix, az), nil, opts...)
+			if err != nil {
+				return nil, err
+			}
+
+			pNGN := fmt.Sprintf("%snat-gateway-%s", resPrefix, az)
+			natGateway, err := ec2.NewNatGateway(ctx, pNGN, &ec2.NatGatewayArgs{
+				SubnetId:     publicSubnet.ID(),
+				AllocationId: eip.ID(),
+				Tags: pulumi.StringMap{
+					"Name": pulumi.String(pNGN),
+				},
+			}, opts...)
+			if err != nil {
+				return nil, err
+			}
+
+			natGateways[az] = natGateway
+			natGatewayList = append(natGatewayList, natGateway)
+		}
+		publicSubnets[i] = publicSubnet
+		publicSubnetRefs[i] = newSubnetRef(publicSubnet, az)
+	}
+
+	var natInstance *ec2.Instance
+	var natInstanceEip *ec2.Eip
+	if natStrategy == NatStrategyInstance {
+		if len(publicSubnets) == 0 {
+			return nil, fmt.Errorf("NAT strategy %q needs at least one public subnet", natStrategy)
+		}
+		natInstance, natInstanceEip, err = createNatInstance(ctx, args, vpc, publicSubnets[0], opts...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i, privateSubnet := range privateSubnets {
+		az := subnetAz(azNames, i)
+
+		privateRouteTable := privateRouteTables[az]
+		if privateRouteTable == nil {
+			var privateRoutes ec2.RouteTableRouteArray
+			switch natStrategy {
+			case NatStrategyPerAz:
+				// AZs without a public subnet have no gateway of their own and stay isolated
+				if natGateways[az] != nil {
+					privateRoutes = append(privateRoutes, &ec2.RouteTableRouteArgs{
+						CidrBlock:    pulumi.String("0.0.0.0/0"),
+						NatGatewayId: natGateways[az].ID(),
+					})
+				}
+			case NatStrategySingle:
+				if len(natGatewayList) > 0 {
+					privateRoutes = append(privateRoutes, &ec2.RouteTableRouteArgs{
+						CidrBlock:    pulumi.String("0.0.0.0/0"),
+						NatGatewayId: natGatewayList[0].ID(),
+					})
+				}
+			case NatStrategyInstance:
+				privateRoutes = append(privateRoutes, &ec2.RouteTableRouteArgs{
+					CidrBlock:          pulumi.String("0.0.0.0/0"),
+					NetworkInterfaceId: natInstance.PrimaryNetworkInterfaceId,
+				})
+			}
+			if egressOnlyGateway != nil {
+				privateRoutes = append(privateRoutes, &ec2.RouteTableRouteArgs{
+					Ipv6CidrBlock:       pulumi.String("::/0"),
+					EgressOnlyGatewayId: egressOnlyGateway.ID(),
+				})
+			}
+			privateRoutes = append(privateRoutes, peerRoutes...)
+
+			privateRouteTable, err = ec2.NewRouteTable(ctx, fmt.Sprintf("%sprivate-rta-%s", resPrefix, az), &ec2.RouteTableArgs{
+				VpcId:  vpc.ID(),
+				Routes: privateRoutes,
+			}, opts...)
+			if err != nil {
+				return nil, err
+			}
+			privateRouteTables[az] = privateRouteTable
+			privateRouteTableList = append(privateRouteTableList, privateRouteTable)
+		}
+
+		prRTAN := subnetResourceName(resPrefix, "private-rta", azNames, i)
+		_, err = ec2.NewRouteTableAssociation(ctx, prRTAN, &ec2.RouteTableAssociationArgs{
+			SubnetId:     privateSubnet.ID(),
+			RouteTableId: privateRouteTable.ID(),
+		}, opts...)
+		if err != nil {
+			return nil, err
+		}
+
+	}
+
+	databaseSubnets, err := createDatabaseSubnets(ctx, args, vpc, databaseSubnetCidrBlocks, azNames, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	natIds := make(pulumi.StringArray, len(natGatewayList))
+	natIps := make(pulumi.StringArray, len(natGatewayList))
+	for i, natGateway := range natGatewayList {
+		natIds[i] = natGateway.ID().ToStringOutput()
+		natIps[i] = natGateway.PublicIp
+	}
+	if natInstance != nil {
+		v.NatInstanceID = natInstance.ID().ToStringOutput()
+		natIps = append(natIps, natInstanceEip.PublicIp)
+	}
+	v.NatStrategy = pulumi.String(natStrategy).ToStringOutput()
+	v.NatGatewayIDs = natIds.ToStringArrayOutput()
+	v.NatPublicIPs = natIps.ToStringArrayOutput()
+
+	network := &vpcNetwork{
+		AvailabilityZones: azNames,
+		VpcID:             vpc.ID().ToStringOutput(),
+		CidrBlock:         vpc.CidrBlock,
+		Ipv6:              enableIpv6,
+		Ipv6CidrBlock:     vpc.Ipv6CidrBlock,
+		PublicSubnets:     publicSubnetRefs,
+		PrivateSubnets:    privateSubnetRefs,
+		DatabaseSubnets:   databaseSubnets,
+		NatInstance:       natInstance != nil,
+	}
+	for _, rt := range privateRouteTableList {
+		network.PrivateRouteTableIDs = append(network.PrivateRouteTableIDs, rt.ID().ToStringOutput())
+	}
+	return network, nil
+}
+
+// Each subnet tier owns a fixed quarter of the VPC's address space, for both IPv4 and IPv6, so that adding a subnet
+// to one tier never renumbers another.
+const (
+	publicTier   = 0
+	privateTier  = 1
+	databaseTier = 2
+)
+
+// maxIpv6SubnetsPerTier is how many /64s a tier's quarter of the Amazon-provided /56 holds.
+const maxIpv6SubnetsPerTier = 1 << (64 - 56 - cidr.TierBits)
+
+// subnetCidrBlocks returns the IPv4 CIDRs of the public, private and database subnets. With PrefixLength set they
+// are carved out of the VPC CIDR, PerAz (default 1) for each resolved AZ, with the database tier only carved when
+// EnableDatabase is set; otherwise the explicit lists are checked against the VPC CIDR and used as-is.
+func subnetCidrBlocks(args SubnetArgs, vpcCIDR string, numAZs int) ([]string, []string, []string, error) {
+	public, private, database := args.PublicCidrs, args.PrivateCidrs, args.DatabaseCidrs
+
+	prefixLen := args.PrefixLength
+	if prefixLen == 0 {
+		if len(public) == 0 {
+			return nil, nil, nil, fmt.Errorf("either public subnet CIDRs or a subnet prefix length must be set")
+		}
+		all := append(append(append([]string{}, public...), private...), database...)
+		if err := cidr.Validate(vpcCIDR, all); err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid subnet CIDRs for VPC %s:\n%w", vpcCIDR, err)
+		}
+		return public, private, database, nil
+	}
+
+	if len(public) > 0 || len(private) > 0 || len(database) > 0 {
+		return nil, nil, nil, fmt.Errorf("a subnet prefix length cannot be combined with explicit subnet CIDRs")
+	}
+
+	perAz := args.PerAz
+	if perAz == 0 {
+		perAz = 1
+	}
+	count := numAZs * perAz
+
+	public, err := cidr.Carve(vpcCIDR, prefixLen, publicTier, count)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	private, err = cidr.Carve(vpcCIDR, prefixLen, privateTier, count)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if args.EnableDatabase {
+		database, err = cidr.Carve(vpcCIDR, prefixLen, databaseTier, count)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	return public, private, database, nil
+}
+
+// subnetCidr returns the IPv4 block of the index'th subnet of a tier, out of the blocks laid out by subnetCidrBlocks.
+// The blocks of an IPAM allocated VPC were laid out on a stand-in, so they are carved again, the same way, from the
+// CIDR that the VPC actually got.
+func subnetCidr(vpc *ec2.Vpc, args *VpcArgs, blocks []string, tier, index int) pulumi.StringInput {
+	if args.Ipam == nil {
+		return pulumi.String(blocks[index])
+	}
+	count := len(blocks)
+	return vpc.CidrBlock.ApplyT(func(block string) (string, error) {
+		carved, err := cidr.Carve(block, args.Subnets.PrefixLength, tier, count)
+		if err != nil {
+			return "", err
+		}
+		return carved[index], nil
+	}).(pulumi.StringOutput)
+}
+
+// ipv6SubnetCidr returns the index'th /64 of the given tier of the Amazon-provided /56 assigned to the VPC.
+func ipv6SubnetCidr(vpc *ec2.Vpc, tier, index int) pulumi.StringOutput {
+	return vpc.Ipv6CidrBlock.ApplyT(func(block string) (string, error) {
+		return ipv6SubnetBlock(block, tier, index)
+	}).(pulumi.StringOutput)
+}
+
+// ipv6SubnetBlock returns the index'th /64 of the given tier of the IPv6 block vpcBlock.
+func ipv6SubnetBlock(vpcBlock string, tier, index int) (string, error) {
+	prefix, err := netip.ParsePrefix(vpcBlock)
+	if err != nil {
+		return "", err
+	}
+	tierBlock, err := cidr.Subnet(prefix, cidr.TierBits, tier)
+	if err != nil {
+		return "", err
+	}
+	subnet, err := cidr.Subnet(tierBlock, 64-tierBlock.Bits(), index)
+	if err != nil {
+		return "", err
+	}
+	return subnet.String(), nil
+}
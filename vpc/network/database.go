@@ -0,0 +1,125 @@
+package network
+
+import (
+	"fmt"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ec2"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/elasticache"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/rds"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// createDatabaseSubnets builds the isolated database tier: one subnet per CIDR, all sharing a route table with no
+// default route. Nothing is created when cidrBlocks is empty.
+func createDatabaseSubnets(
+	ctx *pulumi.Context,
+	args *VpcArgs,
+	vpc *ec2.Vpc,
+	cidrBlocks []string,
+	azNames []string,
+	opts ...pulumi.ResourceOption,
+) ([]subnetRef, error) {
+	if len(cidrBlocks) == 0 {
+		return nil, nil
+	}
+
+	resPrefix := args.ResourcePrefix
+
+	// The route table only has the implicit local routes, so nothing in this tier can reach outside the VPC
+	routeTable, err := ec2.NewRouteTable(ctx, resPrefix+"database-rt", &ec2.RouteTableArgs{
+		VpcId: vpc.ID(),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(resPrefix + "database-rt"),
+		},
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	subnets := make([]subnetRef, len(cidrBlocks))
+	for i := range cidrBlocks {
+		az := subnetAz(azNames, i)
+
+		dbSN := subnetResourceName(resPrefix, "database-subnet", azNames, i)
+		subnetArgs := &ec2.SubnetArgs{
+			VpcId:            vpc.ID(),
+			CidrBlock:        subnetCidr(vpc, args, cidrBlocks, databaseTier, i),
+			AvailabilityZone: pulumi.String(az),
+			Tags: pulumi.StringMap{
+				"Name": pulumi.String(dbSN),
+			},
+		}
+		if args.EnableIpv6 {
+			subnetArgs.Ipv6CidrBlock = ipv6SubnetCidr(vpc, databaseTier, i)
+		}
+		subnet, err := ec2.NewSubnet(ctx, dbSN, subnetArgs, opts...)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = ec2.NewRouteTableAssociation(ctx, subnetResourceName(resPrefix, "database-rta", azNames, i), &ec2.RouteTableAssociationArgs{
+			SubnetId:     subnet.ID(),
+			RouteTableId: routeTable.ID(),
+		}, opts...)
+		if err != nil {
+			return nil, err
+		}
+
+		subnets[i] = newSubnetRef(subnet, az)
+	}
+
+	return subnets, nil
+}
+
+// createDatabaseSubnetGroups groups the database tier into an RDS subnet group, and an ElastiCache one when
+// EnableElastiCacheSubnetGroup is set. Nothing is created without database subnets. RDS wants the subnets of a group
+// in at least two AZs.
+func createDatabaseSubnetGroups(
+	ctx *pulumi.Context,
+	v *Vpc,
+	args *VpcArgs,
+	subnets []subnetRef,
+	opts ...pulumi.ResourceOption,
+) error {
+	if len(subnets) == 0 {
+		return nil
+	}
+	azs := map[string]bool{}
+	for _, subnet := range subnets {
+		azs[subnet.AZ] = true
+	}
+	if len(azs) < 2 {
+		return fmt.Errorf("the database subnets are all in %s, but a DB subnet group needs at least 2 availability zones",
+			subnets[0].AZ)
+	}
+
+	resPrefix := args.ResourcePrefix
+	ids := subnetIDs(subnets)
+
+	dbSubnetGroup, err := rds.NewSubnetGroup(ctx, resPrefix+"db-subnet-group", &rds.SubnetGroupArgs{
+		Name:        pulumi.String(resPrefix + "db-subnet-group"),
+		Description: pulumi.String("Isolated database subnets of " + resPrefix + "vpc"),
+		SubnetIds:   ids,
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(resPrefix + "db-subnet-group"),
+		},
+	}, opts...)
+	if err != nil {
+		return err
+	}
+
+	if args.EnableElastiCacheSubnetGroup {
+		cacheSubnetGroup, err := elasticache.NewSubnetGroup(ctx, resPrefix+"cache-subnet-group", &elasticache.SubnetGroupArgs{
+			Name:        pulumi.String(resPrefix + "cache-subnet-group"),
+			Description: pulumi.String("Isolated database subnets of " + resPrefix + "vpc"),
+			SubnetIds:   ids,
+		}, opts...)
+		if err != nil {
+			return err
+		}
+		v.ElastiCacheSubnetGroupName = cacheSubnetGroup.Name
+	}
+
+	v.DbSubnetGroupName = dbSubnetGroup.Name
+	return nil
+}
@@ -0,0 +1,34 @@
+package network
+
+import (
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ec2"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// restrictVpcDefaults takes over the default security group and default network ACL that AWS creates with every VPC
+// and strips their rules, so that nothing falls back on their allow-all defaults (CIS AWS Foundations 5.4).
+//
+// The default network ACL still guards every subnet that has no ACL of its own, which is why NewVpc insists on the
+// tier network ACLs before it gets here.
+func restrictVpcDefaults(ctx *pulumi.Context, args *VpcArgs, vpc *ec2.Vpc, opts ...pulumi.ResourceOption) error {
+	resPrefix := args.ResourcePrefix
+
+	_, err := ec2.NewDefaultSecurityGroup(ctx, resPrefix+"default-sg", &ec2.DefaultSecurityGroupArgs{
+		VpcId: vpc.ID(),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(resPrefix + "default-sg"),
+		},
+	}, opts...)
+	if err != nil {
+		return err
+	}
+
+	// Subnets cannot be taken off the default ACL, only moved to another one, so leave their associations alone
+	_, err = ec2.NewDefaultNetworkAcl(ctx, resPrefix+"default-nacl", &ec2.DefaultNetworkAclArgs{
+		DefaultNetworkAclId: vpc.DefaultNetworkAclId,
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(resPrefix + "default-nacl"),
+		},
+	}, append(append([]pulumi.ResourceOption{}, opts...), pulumi.IgnoreChanges([]string{"subnetIds"}))...)
+	return err
+}
@@ -0,0 +1,207 @@
+package network
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ec2"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/route53"
+	awsvpc "github.com/pulumi/pulumi-aws/sdk/v6/go/aws/vpc"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// DhcpOptionsArgs tunes the DHCP options set of a created VPC. The search list always starts with the private domain,
+// followed by SearchDomains and the region's default EC2 domain.
+type DhcpOptionsArgs struct {
+	SearchDomains []string
+	// DomainNameServers defaults to AmazonProvidedDNS
+	DomainNameServers []string
+	NtpServers        []string
+}
+
+// ResolverRuleArgs forwards queries for DomainName, and its subdomains, to DNS servers outside the VPC.
+type ResolverRuleArgs struct {
+	DomainName string `json:"domainName"`
+	// TargetIps are the servers to forward to, as ip or ip:port. The port defaults to 53.
+	TargetIps []string `json:"targetIps"`
+}
+
+// createDhcpOptions gives a created VPC a DHCP options set whose search list includes the private domain, so that
+// instances resolve short names in the private hosted zone.
+func createDhcpOptions(ctx *pulumi.Context, v *Vpc, args *VpcArgs, vpc *ec2.Vpc, opts ...pulumi.ResourceOption) error {
+	resPrefix := args.ResourcePrefix
+
+	region, err := aws.GetRegion(ctx, nil, nil)
+	if err != nil {
+		return err
+	}
+	// The domain EC2 gives instance hostnames when the default options are in use
+	defaultDomain := region.Name + ".compute.internal"
+	if region.Name == "us-east-1" {
+		defaultDomain = "ec2.internal"
+	}
+
+	// Most Linux DHCP clients turn a space separated domain name into the resolver's search list
+	searchDomains := append(append([]string{args.PrivateDomainName}, args.DhcpOptions.SearchDomains...), defaultDomain)
+
+	nameServers := args.DhcpOptions.DomainNameServers
+	if len(nameServers) == 0 {
+		nameServers = []string{"AmazonProvidedDNS"}
+	}
+
+	dhcpOptions, err := ec2.NewVpcDhcpOptions(ctx, resPrefix+"dhcp-options", &ec2.VpcDhcpOptionsArgs{
+		DomainName:        pulumi.String(strings.Join(searchDomains, " ")),
+		DomainNameServers: pulumi.ToStringArray(nameServers),
+		NtpServers:        pulumi.ToStringArray(args.DhcpOptions.NtpServers),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(resPrefix + "dhcp-options"),
+		},
+	}, opts...)
+	if err != nil {
+		return err
+	}
+
+	_, err = ec2.NewVpcDhcpOptionsAssociation(ctx, resPrefix+"dhcp-options-association", &ec2.VpcDhcpOptionsAssociationArgs{
+		VpcId:         vpc.ID(),
+		DhcpOptionsId: dhcpOptions.ID(),
+	}, opts...)
+	if err != nil {
+		return err
+	}
+
+	v.DhcpOptionsID = dhcpOptions.ID().ToStringOutput()
+	return nil
+}
+
+// createResolverRules creates an outbound Route 53 Resolver endpoint in the private subnets and a forwarding rule,
+// associated with the VPC, for each of args.ResolverRules. Nothing is created without rules.
+func createResolverRules(
+	ctx *pulumi.Context,
+	v *Vpc,
+	args *VpcArgs,
+	network *vpcNetwork,
+	opts ...pulumi.ResourceOption,
+) error {
+	resPrefix := args.ResourcePrefix
+	v.ResolverRuleIDs = pulumi.StringMap{}.ToStringMapOutput()
+	if len(args.ResolverRules) == 0 {
+		return nil
+	}
+
+	// Parse everything up front so a typo fails before anything is created
+	targets := make([]route53.ResolverRuleTargetIpArray, len(args.ResolverRules))
+	ports := map[int]bool{}
+	for i, rule := range args.ResolverRules {
+		if rule.DomainName == "" || len(rule.TargetIps) == 0 {
+			return fmt.Errorf("resolver rule %d needs a domainName and targetIps", i+1)
+		}
+		for _, target := range rule.TargetIps {
+			addrPort, err := netip.ParseAddrPort(target)
+			if err != nil {
+				addr, addrErr := netip.ParseAddr(target)
+				if addrErr != nil {
+					return fmt.Errorf("invalid target %q of resolver rule for %s: %w", target, rule.DomainName, addrErr)
+				}
+				addrPort = netip.AddrPortFrom(addr, 53)
+			}
+			if !addrPort.Addr().Is4() {
+				return fmt.Errorf("target %s of resolver rule for %s is not an IPv4 address", target, rule.DomainName)
+			}
+			targets[i] = append(targets[i], &route53.ResolverRuleTargetIpArgs{
+				Ip:   pulumi.String(addrPort.Addr().String()),
+				Port: pulumi.Int(int(addrPort.Port())),
+			})
+			ports[int(addrPort.Port())] = true
+		}
+	}
+
+	// The endpoint needs addresses in at least two subnets, preferably in different AZs
+	subnets := firstSubnetPerAz(network.PrivateSubnets)
+	if len(subnets) < 2 {
+		subnets = network.PrivateSubnets
+	}
+	if len(subnets) < 2 {
+		return fmt.Errorf("an outbound resolver endpoint needs at least two private subnets")
+	}
+	var ipAddresses route53.ResolverEndpointIpAddressArray
+	for _, subnet := range subnets {
+		ipAddresses = append(ipAddresses, &route53.ResolverEndpointIpAddressArgs{
+			SubnetId: subnet.ID,
+		})
+	}
+
+	sg, err := ec2.NewSecurityGroup(ctx, resPrefix+"resolver-sg", &ec2.SecurityGroupArgs{
+		VpcId:       network.VpcID,
+		Name:        pulumi.String(resPrefix + "resolver-sg"),
+		Description: pulumi.String("Assigned to the outbound resolver endpoint: allows DNS out to the forwarding targets"),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(resPrefix + "resolver-sg"),
+		},
+	}, opts...)
+	if err != nil {
+		return err
+	}
+
+	for port := range ports {
+		for _, protocol := range []string{"tcp", "udp"} {
+			_, err = awsvpc.NewSecurityGroupEgressRule(ctx, fmt.Sprintf("%sresolver-dns-%s-%d-egress-sgr", resPrefix, protocol, port), &awsvpc.SecurityGroupEgressRuleArgs{
+				Description:     pulumi.String("Allow DNS queries to the forwarding targets"),
+				SecurityGroupId: sg.ID(),
+				IpProtocol:      pulumi.String(protocol),
+				FromPort:        pulumi.Int(port),
+				ToPort:          pulumi.Int(port),
+				CidrIpv4:        pulumi.String("0.0.0.0/0"),
+			}, opts...)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	endpoint, err := route53.NewResolverEndpoint(ctx, resPrefix+"resolver-outbound", &route53.ResolverEndpointArgs{
+		Name:             pulumi.String(resPrefix + "resolver-outbound"),
+		Direction:        pulumi.String("OUTBOUND"),
+		IpAddresses:      ipAddresses,
+		SecurityGroupIds: pulumi.StringArray{sg.ID()},
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(resPrefix + "resolver-outbound"),
+		},
+	}, opts...)
+	if err != nil {
+		return err
+	}
+
+	ruleIds := pulumi.StringMap{}
+	for i, rule := range args.ResolverRules {
+		// Resolver rule names may not contain dots
+		name := resPrefix + "resolver-rule-" + strings.ReplaceAll(strings.TrimSuffix(rule.DomainName, "."), ".", "-")
+		resolverRule, err := route53.NewResolverRule(ctx, name, &route53.ResolverRuleArgs{
+			Name:               pulumi.String(name),
+			DomainName:         pulumi.String(rule.DomainName),
+			RuleType:           pulumi.String("FORWARD"),
+			ResolverEndpointId: endpoint.ID(),
+			TargetIps:          targets[i],
+			Tags: pulumi.StringMap{
+				"Name": pulumi.String(name),
+			},
+		}, opts...)
+		if err != nil {
+			return err
+		}
+
+		_, err = route53.NewResolverRuleAssociation(ctx, name+"-association", &route53.ResolverRuleAssociationArgs{
+			ResolverRuleId: resolverRule.ID(),
+			VpcId:          network.VpcID,
+		}, opts...)
+		if err != nil {
+			return err
+		}
+		ruleIds[rule.DomainName] = resolverRule.ID().ToStringOutput()
+	}
+
+	v.ResolverEndpointID = endpoint.ID().ToStringOutput()
+	v.ResolverRuleIDs = ruleIds.ToStringMapOutput()
+	return nil
+}
@@ -0,0 +1,124 @@
+package network
+
+import (
+	"encoding/json"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/kms"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/route53"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// Route 53 only signs with keys that live in us-east-1, whatever region the rest of the stack is in
+const dnssecKeyRegion = "us-east-1"
+
+// enableDnssec signs the public hosted zone. It creates the ECC_NIST_P256 KMS key that Route 53 signs with, a
+// key-signing key using it and turns on signing for the zone. The zone's DS record ends up in
+// v.PublicZoneDsRecord; signing only takes effect for resolvers once that record is added at the parent zone or
+// registrar.
+func enableDnssec(ctx *pulumi.Context, v *Vpc, args *VpcArgs, zoneID pulumi.StringOutput, opts ...pulumi.ResourceOption) error {
+	resPrefix := args.ResourcePrefix
+
+	caller, err := aws.GetCallerIdentity(ctx, nil, nil)
+	if err != nil {
+		return err
+	}
+	region, err := aws.GetRegion(ctx, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	keyOpts := opts
+	if region.Name != dnssecKeyRegion {
+		// Same credentials as the rest of the stack, so the key lands in the account of the zone and of caller
+		providerArgs, err := stackProviderArgs(ctx)
+		if err != nil {
+			return err
+		}
+		providerArgs.Region = pulumi.String(dnssecKeyRegion)
+		provider, err := aws.NewProvider(ctx, resPrefix+"dnssec-key-provider", providerArgs, opts...)
+		if err != nil {
+			return err
+		}
+		keyOpts = append(append([]pulumi.ResourceOption{}, opts...), pulumi.Provider(provider))
+	}
+
+	// The key policy as documented for DNSSEC signing: the account keeps control of the key and Route 53's DNSSEC
+	// service may use it, but only on behalf of this account.
+	sourceAccount := map[string]interface{}{
+		"StringEquals": map[string]string{"aws:SourceAccount": caller.AccountId},
+	}
+	policy, err := json.Marshal(map[string]interface{}{
+		"Version": "2012-10-17",
+		"Statement": []map[string]interface{}{
+			{
+				"Sid":       "EnableIAMUserPermissions",
+				"Effect":    "Allow",
+				"Principal": map[string]string{"AWS": "arn:aws:iam::" + caller.AccountId + ":root"},
+				"Action":    "kms:*",
+				"Resource":  "*",
+			},
+			{
+				"Sid":       "AllowRoute53DNSSECService",
+				"Effect":    "Allow",
+				"Principal": map[string]string{"Service": "dnssec-route53.amazonaws.com"},
+				"Action":    []string{"kms:DescribeKey", "kms:GetPublicKey", "kms:Sign"},
+				"Resource":  "*",
+				"Condition": sourceAccount,
+			},
+			{
+				"Sid":       "AllowRoute53DNSSECServiceToCreateGrant",
+				"Effect":    "Allow",
+				"Principal": map[string]string{"Service": "dnssec-route53.amazonaws.com"},
+				"Action":    "kms:CreateGrant",
+				"Resource":  "*",
+				"Condition": map[string]interface{}{
+					"Bool": map[string]bool{"kms:GrantIsForAWSResource": true},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	deletionWindow := 30
+	if args.Debug {
+		deletionWindow = 7
+	}
+	key, err := kms.NewKey(ctx, resPrefix+"dnssec-key", &kms.KeyArgs{
+		Description:           pulumi.String("Signs the DNSSEC records of " + args.PublicDomainName),
+		CustomerMasterKeySpec: pulumi.String("ECC_NIST_P256"),
+		KeyUsage:              pulumi.String("SIGN_VERIFY"),
+		DeletionWindowInDays:  pulumi.Int(deletionWindow),
+		Policy:                pulumi.String(string(policy)),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(resPrefix + "dnssec-key"),
+		},
+	}, keyOpts...)
+	if err != nil {
+		return err
+	}
+
+	ksk, err := route53.NewKeySigningKey(ctx, resPrefix+"dnssec-ksk", &route53.KeySigningKeyArgs{
+		HostedZoneId:            zoneID,
+		KeyManagementServiceArn: key.Arn,
+		// Key-signing key names only allow letters, digits and underscores
+		Name:   pulumi.String("ksk"),
+		Status: pulumi.String("ACTIVE"),
+	}, opts...)
+	if err != nil {
+		return err
+	}
+
+	_, err = route53.NewHostedZoneDnsSec(ctx, resPrefix+"dnssec", &route53.HostedZoneDnsSecArgs{
+		HostedZoneId:  ksk.HostedZoneId,
+		SigningStatus: pulumi.String("SIGNING"),
+	}, append(append([]pulumi.ResourceOption{}, opts...), pulumi.DependsOn([]pulumi.Resource{ksk}))...)
+	if err != nil {
+		return err
+	}
+
+	v.PublicZoneDsRecord = ksk.DsRecord
+	return nil
+}
@@ -0,0 +1,135 @@
+package network
+
+import (
+	"fmt"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ec2"
+	awsvpc "github.com/pulumi/pulumi-aws/sdk/v6/go/aws/vpc"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// Services that AWS offers as free gateway endpoints; everything else has to be an interface endpoint.
+var gatewayEndpointServices = map[string]bool{
+	"s3":       true,
+	"dynamodb": true,
+}
+
+// createVpcEndpoints creates the gateway endpoints listed in args.GatewayEndpoints, attached to every private route
+// table, and the interface endpoints listed in args.InterfaceEndpoints, placed in one private subnet per AZ behind a
+// security group that admits HTTPS from the VPC. The endpoint IDs end up in v.VpcEndpointIDs keyed by service name.
+func createVpcEndpoints(
+	ctx *pulumi.Context,
+	v *Vpc,
+	args *VpcArgs,
+	network *vpcNetwork,
+	opts ...pulumi.ResourceOption,
+) error {
+	resPrefix := args.ResourcePrefix
+	gatewayServices, interfaceServices := args.GatewayEndpoints, args.InterfaceEndpoints
+
+	endpointIds := pulumi.StringMap{}
+	v.VpcEndpointIDs = endpointIds.ToStringMapOutput()
+	if len(gatewayServices) == 0 && len(interfaceServices) == 0 {
+		return nil
+	}
+
+	// Both kinds of endpoint are named after their service alone
+	listed := map[string]string{}
+	for _, endpoints := range []struct {
+		kind     string
+		services []string
+	}{{"gateway", gatewayServices}, {"interface", interfaceServices}} {
+		for _, service := range endpoints.services {
+			if kind, ok := listed[service]; ok {
+				return fmt.Errorf("%q is listed as a %s endpoint already, it can only have one endpoint", service, kind)
+			}
+			listed[service] = endpoints.kind
+		}
+	}
+
+	region, err := aws.GetRegion(ctx, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, service := range gatewayServices {
+		if !gatewayEndpointServices[service] {
+			return fmt.Errorf("%q is not available as a gateway endpoint, list it as an interface endpoint instead", service)
+		}
+
+		name := fmt.Sprintf("%svpce-%s", resPrefix, service)
+		endpoint, err := ec2.NewVpcEndpoint(ctx, name, &ec2.VpcEndpointArgs{
+			VpcId:           network.VpcID,
+			ServiceName:     pulumi.Sprintf("com.amazonaws.%s.%s", region.Name, service),
+			VpcEndpointType: pulumi.String("Gateway"),
+			RouteTableIds:   network.PrivateRouteTableIDs,
+			Tags: pulumi.StringMap{
+				"Name": pulumi.String(name),
+			},
+		}, opts...)
+		if err != nil {
+			return err
+		}
+		endpointIds[service] = endpoint.ID().ToStringOutput()
+	}
+
+	v.VpcEndpointIDs = endpointIds.ToStringMapOutput()
+	if len(interfaceServices) == 0 {
+		return nil
+	}
+
+	sg, err := ec2.NewSecurityGroup(ctx, resPrefix+"vpce-sg", &ec2.SecurityGroupArgs{
+		VpcId:       network.VpcID,
+		Name:        pulumi.String(resPrefix + "vpce-sg"),
+		Description: pulumi.String("Assigned to the interface VPC endpoints: allows HTTPS from the VPC"),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(resPrefix + "vpce-sg"),
+		},
+	}, opts...)
+	if err != nil {
+		return err
+	}
+
+	_, err = awsvpc.NewSecurityGroupIngressRule(ctx, resPrefix+"vpce-https-ingress-from-vpc-sgr", &awsvpc.SecurityGroupIngressRuleArgs{
+		Description:     pulumi.String("Allow HTTPS from the VPC to the endpoints"),
+		SecurityGroupId: sg.ID(),
+		IpProtocol:      pulumi.String("tcp"),
+		FromPort:        pulumi.Int(443),
+		ToPort:          pulumi.Int(443),
+		CidrIpv4:        network.CidrBlock,
+	}, opts...)
+	if err != nil {
+		return err
+	}
+
+	subnetIds := subnetIDs(firstSubnetPerAz(network.PrivateSubnets))
+
+	for _, service := range interfaceServices {
+		if gatewayEndpointServices[service] {
+			// S3 does offer interface endpoints too, but the gateway endpoint is free; be explicit about it.
+			ctx.Log.Warn(fmt.Sprintf("%s is also available as a free gateway endpoint", service), nil)
+		}
+
+		name := fmt.Sprintf("%svpce-%s", resPrefix, service)
+		endpoint, err := ec2.NewVpcEndpoint(ctx, name, &ec2.VpcEndpointArgs{
+			VpcId:             network.VpcID,
+			ServiceName:       pulumi.Sprintf("com.amazonaws.%s.%s", region.Name, service),
+			VpcEndpointType:   pulumi.String("Interface"),
+			SubnetIds:         subnetIds,
+			SecurityGroupIds:  pulumi.StringArray{sg.ID()},
+			PrivateDnsEnabled: pulumi.Bool(true),
+			Tags: pulumi.StringMap{
+				"Name": pulumi.String(name),
+			},
+		}, opts...)
+		if err != nil {
+			return err
+		}
+		endpointIds[service] = endpoint.ID().ToStringOutput()
+	}
+
+	v.VpcEndpointIDs = endpointIds.ToStringMapOutput()
+	v.VpcEndpointSecurityGroupID = sg.ID().ToStringOutput()
+	return nil
+}
@@ -0,0 +1,313 @@
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/cloudwatch"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ec2"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/iam"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/s3"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// Values of FlowLogArgs.Destination
+const (
+	FlowLogsToCloudWatch = "cloudwatch"
+	FlowLogsToS3         = "s3"
+)
+
+// Lifecycle defaults and limits of the S3 flow log bucket. S3 only moves objects to STANDARD_IA once they are 30
+// days old.
+const (
+	defaultFlowLogS3ExpirationDays = 365
+	minFlowLogS3TransitionDays     = 30
+)
+
+// checkFlowLogArgs catches flow log settings that AWS would only reject halfway through a deployment.
+func checkFlowLogArgs(args FlowLogArgs) error {
+	switch args.Destination {
+	case "", FlowLogsToCloudWatch, FlowLogsToS3:
+	default:
+		return fmt.Errorf("unknown flow log destination %q, expected %s or %s",
+			args.Destination, FlowLogsToCloudWatch, FlowLogsToS3)
+	}
+	if args.Destination != FlowLogsToS3 {
+		return nil
+	}
+
+	expirationDays := args.S3ExpirationDays
+	if expirationDays == 0 {
+		expirationDays = defaultFlowLogS3ExpirationDays
+	}
+	if expirationDays < 0 {
+		return fmt.Errorf("flow logs cannot expire after %d days", expirationDays)
+	}
+	if transitionDays := args.S3TransitionDays; transitionDays != 0 {
+		if transitionDays < minFlowLogS3TransitionDays {
+			return fmt.Errorf("flow logs can only move to STANDARD_IA after at least %d days, not %d",
+				minFlowLogS3TransitionDays, transitionDays)
+		}
+		if transitionDays >= expirationDays {
+			return fmt.Errorf("flow logs would move to STANDARD_IA after %d days, but expire after %d already",
+				transitionDays, expirationDays)
+		}
+	}
+	return nil
+}
+
+// createFlowLogs turns on VPC flow logs when args.FlowLogs.Destination is set. Logs go either to a CloudWatch log group,
+// written through an IAM role that the VPC flow logs service assumes, or to a private S3 bucket whose lifecycle
+// rules move logs to cheaper storage and eventually expire them. The destination's ARN is published for the
+// cluster stack and for auditors.
+func createFlowLogs(
+	ctx *pulumi.Context,
+	v *Vpc,
+	args *VpcArgs,
+	vpcID pulumi.StringInput,
+	opts ...pulumi.ResourceOption,
+) error {
+	resPrefix := args.ResourcePrefix
+	destination := args.FlowLogs.Destination
+	if destination == "" {
+		return nil
+	}
+
+	trafficType := args.FlowLogs.TrafficType
+	if trafficType == "" {
+		trafficType = "ALL"
+	}
+
+	// An empty format leaves AWS's default format in place
+	var logFormat pulumi.StringPtrInput
+	if format := args.FlowLogs.Format; format != "" {
+		logFormat = pulumi.String(format)
+	}
+
+	flowLogArgs := &ec2.FlowLogArgs{
+		VpcId:       vpcID,
+		TrafficType: pulumi.String(trafficType),
+		LogFormat:   logFormat,
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(resPrefix + "flow-log"),
+		},
+	}
+
+	var destinationArn pulumi.StringOutput
+	// The flow log is only created once its destination accepts deliveries
+	var dependsOn []pulumi.Resource
+	switch destination {
+	case FlowLogsToCloudWatch:
+		retention := args.FlowLogs.RetentionDays
+		if retention == 0 {
+			retention = 30
+		}
+
+		logGroup, err := cloudwatch.NewLogGroup(ctx, resPrefix+"flow-log-group", &cloudwatch.LogGroupArgs{
+			Name:            pulumi.String("/vpc/" + resPrefix + "flow-logs"),
+			RetentionInDays: pulumi.Int(retention),
+		}, opts...)
+		if err != nil {
+			return err
+		}
+
+		assumeRolePolicy, _ := json.Marshal(map[string]interface{}{
+			"Version": "2012-10-17",
+			"Statement": []map[string]interface{}{
+				{
+					"Effect":    "Allow",
+					"Principal": map[string]string{"Service": "vpc-flow-logs.amazonaws.com"},
+					"Action":    "sts:AssumeRole",
+				},
+			},
+		})
+		role, err := iam.NewRole(ctx, resPrefix+"flow-log-role", &iam.RoleArgs{
+			Name:             pulumi.String(resPrefix + "flow-log-role"),
+			Description:      pulumi.String("Lets VPC flow logs write to " + resPrefix + "flow-log-group"),
+			AssumeRolePolicy: pulumi.String(string(assumeRolePolicy)),
+		}, opts...)
+		if err != nil {
+			return err
+		}
+
+		rolePolicy, err := iam.NewRolePolicy(ctx, resPrefix+"flow-log-role-policy", &iam.RolePolicyArgs{
+			Role: role.ID(),
+			Policy: logGroup.Arn.ApplyT(func(arn string) (string, error) {
+				policy, err := json.Marshal(map[string]interface{}{
+					"Version": "2012-10-17",
+					"Statement": []map[string]interface{}{
+						{
+							"Effect": "Allow",
+							"Action": []string{
+								"logs:CreateLogStream",
+								"logs:PutLogEvents",
+								"logs:DescribeLogGroups",
+								"logs:DescribeLogStreams",
+							},
+							"Resource": []string{arn, arn + ":*"},
+						},
+					},
+				})
+				return string(policy), err
+			}).(pulumi.StringOutput),
+		}, opts...)
+		if err != nil {
+			return err
+		}
+
+		flowLogArgs.LogDestinationType = pulumi.String("cloud-watch-logs")
+		flowLogArgs.LogDestination = logGroup.Arn
+		flowLogArgs.IamRoleArn = role.Arn
+		destinationArn = logGroup.Arn
+		dependsOn = append(dependsOn, rolePolicy)
+
+	case FlowLogsToS3:
+		bucket, bucketPolicy, err := createFlowLogBucket(ctx, args, opts...)
+		if err != nil {
+			return err
+		}
+
+		flowLogArgs.LogDestinationType = pulumi.String("s3")
+		flowLogArgs.LogDestination = bucket.Arn
+		destinationArn = bucket.Arn
+		dependsOn = append(dependsOn, bucketPolicy)
+
+	default:
+		return fmt.Errorf("unknown flow log destination %q, expected %s or %s",
+			destination, FlowLogsToCloudWatch, FlowLogsToS3)
+	}
+
+	flowLog, err := ec2.NewFlowLog(ctx, resPrefix+"flow-log", flowLogArgs,
+		append(append([]pulumi.ResourceOption{}, opts...), pulumi.DependsOn(dependsOn))...)
+	if err != nil {
+		return err
+	}
+
+	v.FlowLogID = flowLog.ID().ToStringOutput()
+	v.FlowLogDestinationType = pulumi.String(destination).ToStringOutput()
+	v.FlowLogDestinationArn = destinationArn
+	return nil
+}
+
+// createFlowLogBucket creates the private, encrypted bucket that flow logs are delivered to, along with the policy
+// that lets the log delivery service write to it. Logs move to STANDARD_IA after S3TransitionDays (if set) and are
+// deleted after S3ExpirationDays; checkFlowLogArgs has made sure those fit together.
+func createFlowLogBucket(ctx *pulumi.Context, args *VpcArgs, opts ...pulumi.ResourceOption) (*s3.BucketV2, *s3.BucketPolicy, error) {
+	resPrefix := args.ResourcePrefix
+	debug := args.Debug
+
+	expirationDays := args.FlowLogs.S3ExpirationDays
+	if expirationDays == 0 {
+		expirationDays = defaultFlowLogS3ExpirationDays
+	}
+	transitionDays := args.FlowLogs.S3TransitionDays
+
+	bucket, err := s3.NewBucketV2(ctx, resPrefix+"flow-log-bucket", &s3.BucketV2Args{
+		BucketPrefix: pulumi.String(resPrefix + "flow-logs-"),
+		ForceDestroy: pulumi.Bool(debug),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(resPrefix + "flow-log-bucket"),
+		},
+	}, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, err = s3.NewBucketPublicAccessBlock(ctx, resPrefix+"flow-log-bucket-pab", &s3.BucketPublicAccessBlockArgs{
+		Bucket:                bucket.ID(),
+		BlockPublicAcls:       pulumi.Bool(true),
+		BlockPublicPolicy:     pulumi.Bool(true),
+		IgnorePublicAcls:      pulumi.Bool(true),
+		RestrictPublicBuckets: pulumi.Bool(true),
+	}, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, err = s3.NewBucketServerSideEncryptionConfigurationV2(ctx, resPrefix+"flow-log-bucket-sse", &s3.BucketServerSideEncryptionConfigurationV2Args{
+		Bucket: bucket.ID(),
+		Rules: s3.BucketServerSideEncryptionConfigurationV2RuleArray{
+			&s3.BucketServerSideEncryptionConfigurationV2RuleArgs{
+				ApplyServerSideEncryptionByDefault: &s3.BucketServerSideEncryptionConfigurationV2RuleApplyServerSideEncryptionByDefaultArgs{
+					SseAlgorithm: pulumi.String("AES256"),
+				},
+			},
+		},
+	}, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var transitions s3.BucketLifecycleConfigurationV2RuleTransitionArray
+	if transitionDays > 0 {
+		transitions = append(transitions, &s3.BucketLifecycleConfigurationV2RuleTransitionArgs{
+			Days:         pulumi.Int(transitionDays),
+			StorageClass: pulumi.String("STANDARD_IA"),
+		})
+	}
+	_, err = s3.NewBucketLifecycleConfigurationV2(ctx, resPrefix+"flow-log-bucket-lifecycle", &s3.BucketLifecycleConfigurationV2Args{
+		Bucket: bucket.ID(),
+		Rules: s3.BucketLifecycleConfigurationV2RuleArray{
+			&s3.BucketLifecycleConfigurationV2RuleArgs{
+				Id:          pulumi.String("flow-log-retention"),
+				Status:      pulumi.String("Enabled"),
+				Filter:      &s3.BucketLifecycleConfigurationV2RuleFilterArgs{},
+				Transitions: transitions,
+				Expiration: &s3.BucketLifecycleConfigurationV2RuleExpirationArgs{
+					Days: pulumi.Int(expirationDays),
+				},
+			},
+		},
+	}, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	caller, err := aws.GetCallerIdentity(ctx, nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Delivery permissions for the log delivery service, as documented for flow logs published to S3
+	bucketPolicy, err := s3.NewBucketPolicy(ctx, resPrefix+"flow-log-bucket-policy", &s3.BucketPolicyArgs{
+		Bucket: bucket.ID(),
+		Policy: bucket.Arn.ApplyT(func(arn string) (string, error) {
+			condition := map[string]interface{}{
+				"StringEquals": map[string]string{"aws:SourceAccount": caller.AccountId},
+			}
+			policy, err := json.Marshal(map[string]interface{}{
+				"Version": "2012-10-17",
+				"Statement": []map[string]interface{}{
+					{
+						"Sid":       "AWSLogDeliveryWrite",
+						"Effect":    "Allow",
+						"Principal": map[string]string{"Service": "delivery.logs.amazonaws.com"},
+						"Action":    "s3:PutObject",
+						"Resource":  fmt.Sprintf("%s/AWSLogs/%s/*", arn, caller.AccountId),
+						"Condition": map[string]interface{}{
+							"StringEquals": map[string]string{
+								"aws:SourceAccount": caller.AccountId,
+								"s3:x-amz-acl":      "bucket-owner-full-control",
+							},
+						},
+					},
+					{
+						"Sid":       "AWSLogDeliveryAclCheck",
+						"Effect":    "Allow",
+						"Principal": map[string]string{"Service": "delivery.logs.amazonaws.com"},
+						"Action":    []string{"s3:GetBucketAcl", "s3:ListBucket"},
+						"Resource":  arn,
+						"Condition": condition,
+					},
+				},
+			})
+			return string(policy), err
+		}).(pulumi.StringOutput),
+	}, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return bucket, bucketPolicy, nil
+}
@@ -0,0 +1,295 @@
+package network
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ec2"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// NetworkAclArgs adds a network ACL to every subnet tier when Enable is set. Each ACL denies by default and admits
+// traffic from inside the VPC, return traffic on the ephemeral ports (for the tiers that reach the internet) and
+// whatever its tier's Ingress rules allow.
+type NetworkAclArgs struct {
+	Enable bool
+
+	// EphemeralFromPort and EphemeralToPort bound the ports that return traffic arrives on, by default 1024-65535
+	EphemeralFromPort int
+	EphemeralToPort   int
+
+	// Ingress holds extra ingress rules keyed by tier: public, private or database. The public tier defaults to
+	// HTTP and HTTPS from anywhere, for the load balancer. On a dual-stack VPC every rule from 0.0.0.0/0 is
+	// repeated for ::/0; rules from narrower IPv4 blocks stay IPv4 only, so list IPv6 sources separately.
+	Ingress map[string][]NetworkAclRule
+}
+
+// NetworkAclRule is one ingress rule of a network ACL.
+type NetworkAclRule struct {
+	// Protocol is tcp, udp, icmp or -1 for all protocols. icmp means ICMPv6 for an IPv6 Cidr.
+	Protocol string `json:"protocol"`
+	FromPort int    `json:"fromPort"`
+	ToPort   int    `json:"toPort"`
+	// IcmpType and IcmpCode narrow an icmp rule down, by default it admits every type and code. The types of
+	// ICMPv6 differ from those of ICMP, so a rule with a type is not repeated for IPv6.
+	IcmpType *int `json:"icmpType,omitempty"`
+	IcmpCode *int `json:"icmpCode,omitempty"`
+	// Cidr is the IPv4 or IPv6 block the traffic comes from
+	Cidr string `json:"cidr"`
+	// Action is allow (the default) or deny
+	Action string `json:"action,omitempty"`
+}
+
+// Protocol numbers the ACL entries use for icmp, by address family
+const (
+	icmpProtocol   = "1"
+	icmpv6Protocol = "58"
+)
+
+// Rule numbers of the ACL entries. Configured rules are numbered from networkAclConfiguredRules in the order given.
+const (
+	networkAclVpcRule         = 100
+	networkAclConfiguredRules = 200
+	networkAclEphemeralRules  = 900
+)
+
+// createNetworkAcls creates one network ACL per subnet tier and associates it with the tier's subnets. Tiers
+// without subnets get no ACL.
+func createNetworkAcls(
+	ctx *pulumi.Context,
+	v *Vpc,
+	args *VpcArgs,
+	network *vpcNetwork,
+	opts ...pulumi.ResourceOption,
+) error {
+	v.NetworkAclIDs = pulumi.StringMap{}.ToStringMapOutput()
+	if !args.NetworkAcls.Enable {
+		return nil
+	}
+	if args.Existing != nil {
+		return fmt.Errorf("network ACLs can only be managed for a VPC this stack creates")
+	}
+
+	for tier := range args.NetworkAcls.Ingress {
+		if tier != "public" && tier != "private" && tier != "database" {
+			return fmt.Errorf("network ACL rules for unknown tier %q, expected public, private or database", tier)
+		}
+	}
+
+	fromPort, toPort := args.NetworkAcls.EphemeralFromPort, args.NetworkAcls.EphemeralToPort
+	if fromPort == 0 {
+		fromPort = 1024
+	}
+	if toPort == 0 {
+		toPort = 65535
+	}
+
+	ids := pulumi.StringMap{}
+	for _, tier := range []struct {
+		name     string
+		subnets  []subnetRef
+		internet bool
+		defaults []NetworkAclRule
+	}{
+		{"public", network.PublicSubnets, true, []NetworkAclRule{
+			{Protocol: "tcp", FromPort: 80, ToPort: 80, Cidr: "0.0.0.0/0"},
+			{Protocol: "tcp", FromPort: 443, ToPort: 443, Cidr: "0.0.0.0/0"},
+		}},
+		{"private", network.PrivateSubnets, true, nil},
+		// The database tier has no route out of the VPC, so it neither sends nor expects internet traffic
+		{"database", network.DatabaseSubnets, false, nil},
+	} {
+		if len(tier.subnets) == 0 {
+			continue
+		}
+
+		rules, ok := args.NetworkAcls.Ingress[tier.name]
+		if !ok {
+			rules = tier.defaults
+		}
+		if network.Ipv6 {
+			rules = append(append([]NetworkAclRule{}, rules...), ipv6Variants(rules)...)
+		}
+
+		ingress, err := networkAclIngress(network, rules, tier.internet, fromPort, toPort)
+		if err != nil {
+			return fmt.Errorf("network ACL of the %s tier: %w", tier.name, err)
+		}
+
+		egress := ec2.NetworkAclEgressArray{
+			&ec2.NetworkAclEgressArgs{
+				RuleNo:    pulumi.Int(networkAclVpcRule),
+				Action:    pulumi.String("allow"),
+				Protocol:  pulumi.String("-1"),
+				FromPort:  pulumi.Int(0),
+				ToPort:    pulumi.Int(0),
+				CidrBlock: egressCidr(tier.internet, "0.0.0.0/0", network.CidrBlock),
+			},
+		}
+		if network.Ipv6 {
+			egress = append(egress, &ec2.NetworkAclEgressArgs{
+				RuleNo:        pulumi.Int(networkAclVpcRule + 1),
+				Action:        pulumi.String("allow"),
+				Protocol:      pulumi.String("-1"),
+				FromPort:      pulumi.Int(0),
+				ToPort:        pulumi.Int(0),
+				Ipv6CidrBlock: egressCidr(tier.internet, "::/0", network.Ipv6CidrBlock),
+			})
+		}
+
+		name := args.ResourcePrefix + tier.name + "-nacl"
+		acl, err := ec2.NewNetworkAcl(ctx, name, &ec2.NetworkAclArgs{
+			VpcId:     network.VpcID,
+			SubnetIds: subnetIDs(tier.subnets),
+			Ingress:   ingress,
+			Egress:    egress,
+			Tags: pulumi.StringMap{
+				"Name": pulumi.String(name),
+			},
+		}, opts...)
+		if err != nil {
+			return err
+		}
+		ids[tier.name] = acl.ID().ToStringOutput()
+	}
+
+	v.NetworkAclIDs = ids.ToStringMapOutput()
+	return nil
+}
+
+// networkAclIngress builds the ingress entries of one tier: everything from inside the VPC, the configured rules
+// and, for tiers that talk to the internet, TCP and UDP return traffic on the ephemeral ports.
+func networkAclIngress(
+	network *vpcNetwork,
+	rules []NetworkAclRule,
+	internet bool,
+	ephemeralFromPort, ephemeralToPort int,
+) (ec2.NetworkAclIngressArray, error) {
+	ingress := ec2.NetworkAclIngressArray{
+		&ec2.NetworkAclIngressArgs{
+			RuleNo:    pulumi.Int(networkAclVpcRule),
+			Action:    pulumi.String("allow"),
+			Protocol:  pulumi.String("-1"),
+			FromPort:  pulumi.Int(0),
+			ToPort:    pulumi.Int(0),
+			CidrBlock: network.CidrBlock,
+		},
+	}
+	if network.Ipv6 {
+		ingress = append(ingress, &ec2.NetworkAclIngressArgs{
+			RuleNo:        pulumi.Int(networkAclVpcRule + 1),
+			Action:        pulumi.String("allow"),
+			Protocol:      pulumi.String("-1"),
+			FromPort:      pulumi.Int(0),
+			ToPort:        pulumi.Int(0),
+			Ipv6CidrBlock: network.Ipv6CidrBlock,
+		})
+	}
+
+	if len(rules) > networkAclEphemeralRules-networkAclConfiguredRules {
+		return nil, fmt.Errorf("too many rules (%d)", len(rules))
+	}
+	for i, rule := range rules {
+		action := rule.Action
+		if action == "" {
+			action = "allow"
+		}
+		if action != "allow" && action != "deny" {
+			return nil, fmt.Errorf("unknown action %q, expected allow or deny", rule.Action)
+		}
+		if rule.Cidr == "" {
+			return nil, fmt.Errorf("rule %d has no cidr", i+1)
+		}
+		ipv6 := strings.Contains(rule.Cidr, ":")
+
+		entry := &ec2.NetworkAclIngressArgs{
+			RuleNo:   pulumi.Int(networkAclConfiguredRules + i),
+			Action:   pulumi.String(action),
+			Protocol: pulumi.String(rule.Protocol),
+			FromPort: pulumi.Int(rule.FromPort),
+			ToPort:   pulumi.Int(rule.ToPort),
+		}
+		switch rule.Protocol {
+		case "tcp", "udp", "-1":
+			if rule.IcmpType != nil || rule.IcmpCode != nil {
+				return nil, fmt.Errorf("rule %d sets an ICMP type or code on protocol %s", i+1, rule.Protocol)
+			}
+		case "icmp":
+			// Ports mean nothing to ICMP, -1 admits every type or code
+			icmpType, icmpCode := -1, -1
+			if rule.IcmpType != nil {
+				icmpType = *rule.IcmpType
+			}
+			if rule.IcmpCode != nil {
+				icmpCode = *rule.IcmpCode
+			}
+			entry.Protocol = pulumi.String(icmpProtocol)
+			if ipv6 {
+				entry.Protocol = pulumi.String(icmpv6Protocol)
+			}
+			entry.FromPort = pulumi.Int(0)
+			entry.ToPort = pulumi.Int(0)
+			entry.IcmpType = pulumi.Int(icmpType)
+			entry.IcmpCode = pulumi.Int(icmpCode)
+		default:
+			return nil, fmt.Errorf("rule %d has unknown protocol %q, expected tcp, udp, icmp or -1", i+1, rule.Protocol)
+		}
+		if ipv6 {
+			entry.Ipv6CidrBlock = pulumi.String(rule.Cidr)
+		} else {
+			entry.CidrBlock = pulumi.String(rule.Cidr)
+		}
+		ingress = append(ingress, entry)
+	}
+
+	if internet {
+		ruleNo := networkAclEphemeralRules
+		for _, protocol := range []string{"tcp", "udp"} {
+			ingress = append(ingress, &ec2.NetworkAclIngressArgs{
+				RuleNo:    pulumi.Int(ruleNo),
+				Action:    pulumi.String("allow"),
+				Protocol:  pulumi.String(protocol),
+				FromPort:  pulumi.Int(ephemeralFromPort),
+				ToPort:    pulumi.Int(ephemeralToPort),
+				CidrBlock: pulumi.String("0.0.0.0/0"),
+			})
+			ruleNo++
+			if network.Ipv6 {
+				ingress = append(ingress, &ec2.NetworkAclIngressArgs{
+					RuleNo:        pulumi.Int(ruleNo),
+					Action:        pulumi.String("allow"),
+					Protocol:      pulumi.String(protocol),
+					FromPort:      pulumi.Int(ephemeralFromPort),
+					ToPort:        pulumi.Int(ephemeralToPort),
+					Ipv6CidrBlock: pulumi.String("::/0"),
+				})
+				ruleNo++
+			}
+		}
+	}
+	return ingress, nil
+}
+
+// egressCidr lets tiers that talk to the internet send anywhere and keeps the others inside the VPC.
+func egressCidr(internet bool, anywhere string, vpcCidr pulumi.StringOutput) pulumi.StringPtrInput {
+	if internet {
+		return pulumi.String(anywhere)
+	}
+	return vpcCidr
+}
+
+// ipv6Variants returns a copy of the IPv4 "anywhere" rules that admits the same traffic over IPv6. ICMP rules for
+// particular types are left out, as ICMPv6 numbers its types differently.
+func ipv6Variants(rules []NetworkAclRule) []NetworkAclRule {
+	var variants []NetworkAclRule
+	for _, rule := range rules {
+		if rule.Protocol == "icmp" && (rule.IcmpType != nil || rule.IcmpCode != nil) {
+			continue
+		}
+		if rule.Cidr == "0.0.0.0/0" {
+			rule.Cidr = "::/0"
+			variants = append(variants, rule)
+		}
+	}
+	return variants
+}
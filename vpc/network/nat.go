@@ -0,0 +1,146 @@
+package network
+
+import (
+	"fmt"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ec2"
+	awsvpc "github.com/pulumi/pulumi-aws/sdk/v6/go/aws/vpc"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// Values of NatArgs.Strategy
+const (
+	// NatStrategyPerAz puts a NAT gateway in every AZ that has a public subnet
+	NatStrategyPerAz = "perAz"
+	// NatStrategySingle shares one NAT gateway between all private subnets
+	NatStrategySingle = "single"
+	// NatStrategyInstance routes private subnets through a small fck-nat EC2 instance
+	NatStrategyInstance = "instance"
+	// NatStrategyNone leaves private subnets without an IPv4 route to the internet
+	NatStrategyNone = "none"
+)
+
+// fck-nat publishes its AMIs from this account, see https://fck-nat.dev
+const fckNatAmiOwner = "568608671756"
+
+// defaultNatInstanceTypes are the NAT instance types for each architecture fck-nat is built for, the smallest that
+// can run it
+var defaultNatInstanceTypes = map[string]string{
+	"arm64":  "t4g.nano",
+	"x86_64": "t3.nano",
+}
+
+func checkNatStrategy(strategy string) (string, error) {
+	switch strategy {
+	case "":
+		return NatStrategyPerAz, nil
+	case NatStrategyPerAz, NatStrategySingle, NatStrategyInstance, NatStrategyNone:
+		return strategy, nil
+	}
+	return "", fmt.Errorf("unknown NAT strategy %q, expected one of %s, %s, %s or %s",
+		strategy, NatStrategyPerAz, NatStrategySingle, NatStrategyInstance, NatStrategyNone)
+}
+
+// createNatInstance launches a fck-nat instance in the given public subnet. Source/dest checking is turned off so
+// that it can forward traffic for the private subnets, and it gets an Elastic IP so outbound traffic keeps a stable
+// address across instance replacements.
+func createNatInstance(
+	ctx *pulumi.Context,
+	args *VpcArgs,
+	vpc *ec2.Vpc,
+	subnet *ec2.Subnet,
+	opts ...pulumi.ResourceOption,
+) (*ec2.Instance, *ec2.Eip, error) {
+	resPrefix := args.ResourcePrefix
+	arch := args.Nat.InstanceArchitecture
+	if arch == "" {
+		arch = "arm64"
+	}
+	instanceType := args.Nat.InstanceType
+	if instanceType == "" {
+		instanceType = defaultNatInstanceTypes[arch]
+	}
+	if instanceType == "" {
+		return nil, nil, fmt.Errorf("unknown NAT instance architecture %q, expected arm64 or x86_64", arch)
+	}
+
+	amiID := args.Nat.InstanceAmi
+	if amiID == "" {
+		ami, err := ec2.LookupAmi(ctx, &ec2.LookupAmiArgs{
+			MostRecent: pulumi.BoolRef(true),
+			Owners:     []string{fckNatAmiOwner},
+			Filters: []ec2.GetAmiFilter{
+				{
+					Name:   "name",
+					Values: []string{"fck-nat-al2023-*"},
+				},
+				{
+					Name:   "architecture",
+					Values: []string{arch},
+				},
+			},
+		}, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		amiID = ami.Id
+	}
+
+	sg, err := ec2.NewSecurityGroup(ctx, resPrefix+"nat-instance-sg", &ec2.SecurityGroupArgs{
+		VpcId:       vpc.ID(),
+		Name:        pulumi.String(resPrefix + "nat-instance-sg"),
+		Description: pulumi.String("Assigned to the NAT instance: allows all traffic from the VPC out to the world"),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(resPrefix + "nat-instance-sg"),
+		},
+	}, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, err = awsvpc.NewSecurityGroupIngressRule(ctx, resPrefix+"nat-instance-ingress-from-vpc-sgr", &awsvpc.SecurityGroupIngressRuleArgs{
+		Description:     pulumi.String("Allow all traffic from the VPC to be translated"),
+		SecurityGroupId: sg.ID(),
+		IpProtocol:      pulumi.String("-1"),
+		CidrIpv4:        vpc.CidrBlock,
+	}, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, err = awsvpc.NewSecurityGroupEgressRule(ctx, resPrefix+"nat-instance-egress-sgr", &awsvpc.SecurityGroupEgressRuleArgs{
+		Description:     pulumi.String("Allow all traffic out of the NAT instance"),
+		SecurityGroupId: sg.ID(),
+		IpProtocol:      pulumi.String("-1"),
+		CidrIpv4:        pulumi.String("0.0.0.0/0"),
+	}, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	inst, err := ec2.NewInstance(ctx, resPrefix+"nat-instance", &ec2.InstanceArgs{
+		InstanceType:        pulumi.String(instanceType),
+		Ami:                 pulumi.String(amiID),
+		SubnetId:            subnet.ID(),
+		SourceDestCheck:     pulumi.Bool(false),
+		VpcSecurityGroupIds: pulumi.StringArray{sg.ID()},
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(resPrefix + "nat-instance"),
+		},
+	}, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	eip, err := ec2.NewEip(ctx, resPrefix+"eip-nat-instance", &ec2.EipArgs{
+		Instance: inst.ID(),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(resPrefix + "eip-nat-instance"),
+		},
+	}, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return inst, eip, nil
+}
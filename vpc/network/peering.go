@@ -0,0 +1,229 @@
+package network
+
+import (
+	"copr-pulumi-go-aws-vpc/cidr"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ec2"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ec2transitgateway"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// TransitGatewayArgs attaches the VPC to an existing transit gateway.
+type TransitGatewayArgs struct {
+	ID string
+	// RouteCidrs are the networks behind the transit gateway, routed to it from the public and private subnets
+	RouteCidrs []string
+}
+
+// PeeringArgs peers the VPC with another VPC. The connection is accepted by this stack for a peer in this account,
+// and for a peer in another account when AccepterRoleArn is set. Otherwise the peer's owner has to accept it, and
+// the routes to the peer are only added once Accepted says so; until then they would lead nowhere.
+type PeeringArgs struct {
+	VpcID string `json:"vpcId"`
+	// OwnerID is the peer's account, by default this one
+	OwnerID string `json:"ownerId,omitempty"`
+	// Region is the peer's region, by default this one
+	Region string `json:"region,omitempty"`
+	// Cidrs are the peer's networks, routed to it from the public and private subnets
+	Cidrs []string `json:"cidrs"`
+	// AccepterRoleArn is a role in the peer's account that this stack accepts the connection with
+	AccepterRoleArn string `json:"accepterRoleArn,omitempty"`
+	// Accepted is set once the peer has accepted a connection that this stack does not accept itself
+	Accepted bool `json:"accepted,omitempty"`
+}
+
+// checkPeerCidrs makes sure that the networks routed to through the transit gateway and the peerings neither
+// overlap each other nor vpcCIDR, which is empty when the VPC's CIDR is not known yet.
+func checkPeerCidrs(args *VpcArgs, vpcCIDR string) error {
+	var cidrs []string
+	if args.TransitGateway != nil {
+		cidrs = append(cidrs, args.TransitGateway.RouteCidrs...)
+	}
+	for _, peer := range args.Peerings {
+		cidrs = append(cidrs, peer.Cidrs...)
+	}
+	if err := cidr.ValidatePeers(vpcCIDR, cidrs); err != nil {
+		return fmt.Errorf("invalid peer networks:\n%w", err)
+	}
+	return nil
+}
+
+// createPeerConnections attaches the VPC to a transit gateway and peers it with other VPCs as args asks, and
+// returns the routes to the networks behind them. The database tier does not get these routes; it stays isolated.
+func createPeerConnections(
+	ctx *pulumi.Context,
+	v *Vpc,
+	args *VpcArgs,
+	vpc *ec2.Vpc,
+	privateSubnets []subnetRef,
+	opts ...pulumi.ResourceOption,
+) (ec2.RouteTableRouteArray, error) {
+	resPrefix := args.ResourcePrefix
+
+	// checkPeerCidrs has vetted the CIDRs already
+	var routes ec2.RouteTableRouteArray
+	var peerCidrs []string
+	addRoutes := func(cidrs []string, target func(*ec2.RouteTableRouteArgs)) error {
+		for _, cidr := range cidrs {
+			prefix, err := netip.ParsePrefix(cidr)
+			if err != nil {
+				return fmt.Errorf("invalid peer CIDR %q: %w", cidr, err)
+			}
+
+			route := &ec2.RouteTableRouteArgs{}
+			if prefix.Addr().Is6() {
+				route.Ipv6CidrBlock = pulumi.String(prefix.String())
+			} else {
+				route.CidrBlock = pulumi.String(prefix.String())
+			}
+			target(route)
+			routes = append(routes, route)
+			peerCidrs = append(peerCidrs, prefix.String())
+		}
+		return nil
+	}
+
+	v.TransitGatewayAttachmentID = pulumi.String("").ToStringOutput()
+	if tgw := args.TransitGateway; tgw != nil {
+		if len(privateSubnets) == 0 {
+			return nil, fmt.Errorf("a transit gateway attachment needs private subnets to attach to")
+		}
+
+		ipv6Support := "disable"
+		if args.EnableIpv6 {
+			ipv6Support = "enable"
+		}
+
+		// The attachment takes one subnet per AZ; traffic from every subnet in an AZ goes through it
+		attachment, err := ec2transitgateway.NewVpcAttachment(ctx, resPrefix+"tgw-attachment", &ec2transitgateway.VpcAttachmentArgs{
+			TransitGatewayId: pulumi.String(tgw.ID),
+			VpcId:            vpc.ID(),
+			SubnetIds:        subnetIDs(firstSubnetPerAz(privateSubnets)),
+			Ipv6Support:      pulumi.String(ipv6Support),
+			Tags: pulumi.StringMap{
+				"Name": pulumi.String(resPrefix + "tgw-attachment"),
+			},
+		}, opts...)
+		if err != nil {
+			return nil, err
+		}
+		v.TransitGatewayAttachmentID = attachment.ID().ToStringOutput()
+
+		// Routing through the attachment's output holds the routes back until the VPC is actually attached
+		err = addRoutes(tgw.RouteCidrs, func(route *ec2.RouteTableRouteArgs) {
+			route.TransitGatewayId = attachment.TransitGatewayId
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	peeringIds := pulumi.StringMap{}
+	for _, peer := range args.Peerings {
+		if peer.VpcID == "" {
+			return nil, fmt.Errorf("a VPC peering is missing the peer's vpcId")
+		}
+
+		name := fmt.Sprintf("%speering-%s", resPrefix, peer.VpcID)
+		peeringArgs := &ec2.VpcPeeringConnectionArgs{
+			VpcId:     vpc.ID(),
+			PeerVpcId: pulumi.String(peer.VpcID),
+			// Auto-accepting only works for a peer in the same account and region, see acceptPeering for the rest
+			AutoAccept: pulumi.Bool(peer.OwnerID == "" && peer.Region == ""),
+			Tags: pulumi.StringMap{
+				"Name": pulumi.String(name),
+			},
+		}
+		if peer.OwnerID != "" {
+			peeringArgs.PeerOwnerId = pulumi.String(peer.OwnerID)
+		}
+		if peer.Region != "" {
+			peeringArgs.PeerRegion = pulumi.String(peer.Region)
+		}
+		peering, err := ec2.NewVpcPeeringConnection(ctx, name, peeringArgs, opts...)
+		if err != nil {
+			return nil, err
+		}
+		peeringIds[peer.VpcID] = peering.ID().ToStringOutput()
+
+		// Routes go through the accepted connection, which holds them back until it is accepted
+		connectionID := peering.ID().ToStringOutput()
+		switch {
+		case peer.OwnerID == "" && peer.Region == "":
+			// Accepted as it is created
+		case peer.OwnerID == "" || peer.AccepterRoleArn != "":
+			accepter, err := acceptPeering(ctx, name, peer, peering, opts...)
+			if err != nil {
+				return nil, fmt.Errorf("peering with %s: %w", peer.VpcID, err)
+			}
+			connectionID = accepter.VpcPeeringConnectionId
+		case !peer.Accepted:
+			ctx.Log.Warn(fmt.Sprintf("The peering with %s waits for its owner to accept it. Its routes are added "+
+				"once it is marked as accepted.", peer.VpcID), nil)
+			continue
+		}
+
+		err = addRoutes(peer.Cidrs, func(route *ec2.RouteTableRouteArgs) {
+			route.VpcPeeringConnectionId = connectionID
+		})
+		if err != nil {
+			return nil, fmt.Errorf("peering with %s: %w", peer.VpcID, err)
+		}
+	}
+
+	var v4, v6 []string
+	for _, cidr := range peerCidrs {
+		if strings.Contains(cidr, ":") {
+			v6 = append(v6, cidr)
+		} else {
+			v4 = append(v4, cidr)
+		}
+	}
+	v.PeerCidrs = pulumi.ToStringArray(v4).ToStringArrayOutput()
+	v.PeerIpv6Cidrs = pulumi.ToStringArray(v6).ToStringArrayOutput()
+	v.VpcPeeringConnectionIDs = peeringIds.ToStringMapOutput()
+	return routes, nil
+}
+
+// acceptPeering accepts a peering connection on the peer's side, through a provider in the peer's region that
+// reaches the peer's account through peer.AccepterRoleArn, or else with the stack's own credentials.
+func acceptPeering(
+	ctx *pulumi.Context,
+	name string,
+	peer PeeringArgs,
+	peering *ec2.VpcPeeringConnection,
+	opts ...pulumi.ResourceOption,
+) (*ec2.VpcPeeringConnectionAccepter, error) {
+	providerArgs, err := stackProviderArgs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if peer.Region != "" {
+		providerArgs.Region = pulumi.String(peer.Region)
+	}
+	if peer.AccepterRoleArn != "" {
+		// The stack's account restrictions would only lock the provider out of the peer's account
+		providerArgs.AllowedAccountIds = nil
+		providerArgs.ForbiddenAccountIds = nil
+		providerArgs.AssumeRole = &aws.ProviderAssumeRoleArgs{
+			RoleArn:     pulumi.String(peer.AccepterRoleArn),
+			SessionName: pulumi.String(name + "-accepter"),
+		}
+	}
+	provider, err := aws.NewProvider(ctx, name+"-accepter-provider", providerArgs, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return ec2.NewVpcPeeringConnectionAccepter(ctx, name+"-accepter", &ec2.VpcPeeringConnectionAccepterArgs{
+		VpcPeeringConnectionId: peering.ID(),
+		AutoAccept:             pulumi.Bool(true),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(name),
+		},
+	}, append(append([]pulumi.ResourceOption{}, opts...), pulumi.Provider(provider))...)
+}
@@ -0,0 +1,102 @@
+package network
+
+import (
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi/config"
+)
+
+// stackAssumeRole is the aws:assumeRole stack setting, as the default provider reads it.
+type stackAssumeRole struct {
+	RoleArn           string            `json:"roleArn"`
+	SessionName       string            `json:"sessionName"`
+	ExternalID        string            `json:"externalId"`
+	Duration          string            `json:"duration"`
+	Policy            string            `json:"policy"`
+	PolicyArns        []string          `json:"policyArns"`
+	SourceIdentity    string            `json:"sourceIdentity"`
+	Tags              map[string]string `json:"tags"`
+	TransitiveTagKeys []string          `json:"transitiveTagKeys"`
+}
+
+// stackProviderArgs returns the settings of the stack's default AWS provider, read from the aws: configuration. An
+// explicit provider starts from these so that it uses the same credentials and account as everything else, and only
+// overrides what it is created for, such as the region.
+func stackProviderArgs(ctx *pulumi.Context) (*aws.ProviderArgs, error) {
+	cfg := config.New(ctx, "aws")
+	providerArgs := &aws.ProviderArgs{}
+
+	for key, arg := range map[string]*pulumi.StringPtrInput{
+		"region":  &providerArgs.Region,
+		"profile": &providerArgs.Profile,
+	} {
+		if value := cfg.Get(key); value != "" {
+			*arg = pulumi.String(value)
+		}
+	}
+	// Credentials stay secret in the provider's state
+	for key, arg := range map[string]*pulumi.StringPtrInput{
+		"accessKey": &providerArgs.AccessKey,
+		"secretKey": &providerArgs.SecretKey,
+		"token":     &providerArgs.Token,
+	} {
+		if cfg.Get(key) != "" {
+			*arg = cfg.GetSecret(key)
+		}
+	}
+
+	for key, arg := range map[string]*pulumi.StringArrayInput{
+		"sharedConfigFiles":      &providerArgs.SharedConfigFiles,
+		"sharedCredentialsFiles": &providerArgs.SharedCredentialsFiles,
+		"allowedAccountIds":      &providerArgs.AllowedAccountIds,
+		"forbiddenAccountIds":    &providerArgs.ForbiddenAccountIds,
+	} {
+		var list []string
+		if err := cfg.GetObject(key, &list); err != nil {
+			return nil, err
+		}
+		if list != nil {
+			*arg = pulumi.ToStringArray(list)
+		}
+	}
+
+	var assumeRole *stackAssumeRole
+	if err := cfg.GetObject("assumeRole", &assumeRole); err != nil {
+		return nil, err
+	}
+	if assumeRole != nil {
+		providerArgs.AssumeRole = &aws.ProviderAssumeRoleArgs{
+			RoleArn:           stringPtr(assumeRole.RoleArn),
+			SessionName:       stringPtr(assumeRole.SessionName),
+			ExternalId:        stringPtr(assumeRole.ExternalID),
+			Duration:          stringPtr(assumeRole.Duration),
+			Policy:            stringPtr(assumeRole.Policy),
+			PolicyArns:        pulumi.ToStringArray(assumeRole.PolicyArns),
+			SourceIdentity:    stringPtr(assumeRole.SourceIdentity),
+			Tags:              pulumi.ToStringMap(assumeRole.Tags),
+			TransitiveTagKeys: pulumi.ToStringArray(assumeRole.TransitiveTagKeys),
+		}
+	}
+
+	var defaultTags *struct {
+		Tags map[string]string `json:"tags"`
+	}
+	if err := cfg.GetObject("defaultTags", &defaultTags); err != nil {
+		return nil, err
+	}
+	if defaultTags != nil {
+		providerArgs.DefaultTags = &aws.ProviderDefaultTagsArgs{
+			Tags: pulumi.ToStringMap(defaultTags.Tags),
+		}
+	}
+
+	return providerArgs, nil
+}
+
+// stringPtr leaves empty settings unset rather than passing an empty string to the provider.
+func stringPtr(value string) pulumi.StringPtrInput {
+	if value == "" {
+		return nil
+	}
+	return pulumi.String(value)
+}
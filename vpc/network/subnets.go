@@ -0,0 +1,94 @@
+package network
+
+import (
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ec2"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// vpcNetwork describes the VPC the rest of the stack builds on, whether it was created by this stack or adopted.
+type vpcNetwork struct {
+	// AvailabilityZones lists the AZs the subnets are spread over
+	AvailabilityZones []string
+
+	VpcID     pulumi.StringOutput
+	CidrBlock pulumi.StringOutput
+
+	// Ipv6 is set when the VPC has an IPv6 block and its subnets carry IPv6 /64s
+	Ipv6          bool
+	Ipv6CidrBlock pulumi.StringOutput
+
+	PublicSubnets   []subnetRef
+	PrivateSubnets  []subnetRef
+	DatabaseSubnets []subnetRef
+
+	PrivateRouteTableIDs pulumi.StringArray
+
+	// NatInstance is set when private subnets route through a NAT instance rather than gateways
+	NatInstance bool
+}
+
+// subnetRef is a subnet of the VPC along with the AZ it lives in.
+type subnetRef struct {
+	ID            pulumi.StringOutput
+	AZ            string
+	Ipv6CidrBlock pulumi.StringOutput
+}
+
+func newSubnetRef(subnet *ec2.Subnet, az string) subnetRef {
+	return subnetRef{
+		ID:            subnet.ID().ToStringOutput(),
+		AZ:            az,
+		Ipv6CidrBlock: subnet.Ipv6CidrBlock.Elem(),
+	}
+}
+
+func subnetIDs(subnets []subnetRef) pulumi.StringArray {
+	ids := make(pulumi.StringArray, len(subnets))
+	for i, subnet := range subnets {
+		ids[i] = subnet.ID
+	}
+	return ids
+}
+
+// subnetsByAz maps each AZ to the IDs of its subnets, in subnet order.
+func subnetsByAz(subnets []subnetRef) pulumi.StringArrayMap {
+	byAz := make(map[string]pulumi.StringArray, len(subnets))
+	for _, subnet := range subnets {
+		byAz[subnet.AZ] = append(byAz[subnet.AZ], subnet.ID)
+	}
+	ids := make(pulumi.StringArrayMap, len(byAz))
+	for az, azIds := range byAz {
+		ids[az] = azIds
+	}
+	return ids
+}
+
+func subnetAZs(subnets []subnetRef) pulumi.StringArray {
+	azs := make(pulumi.StringArray, len(subnets))
+	for i, subnet := range subnets {
+		azs[i] = pulumi.String(subnet.AZ)
+	}
+	return azs
+}
+
+func subnetIpv6CIDRs(subnets []subnetRef) pulumi.StringArray {
+	cidrs := make(pulumi.StringArray, len(subnets))
+	for i, subnet := range subnets {
+		cidrs[i] = subnet.Ipv6CidrBlock
+	}
+	return cidrs
+}
+
+// firstSubnetPerAz picks one subnet from each AZ, for resources such as interface endpoints that accept at most
+// one subnet per AZ.
+func firstSubnetPerAz(subnets []subnetRef) []subnetRef {
+	seen := make(map[string]bool, len(subnets))
+	var picked []subnetRef
+	for _, subnet := range subnets {
+		if !seen[subnet.AZ] {
+			seen[subnet.AZ] = true
+			picked = append(picked, subnet)
+		}
+	}
+	return picked
+}
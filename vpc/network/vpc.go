@@ -0,0 +1,423 @@
+// Package network builds the network a COPR cluster runs in as a single pulumi component.
+package network
+
+import (
+	"fmt"
+
+	"copr-pulumi-go-aws-outputs"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// VpcArgs configures a Vpc. Only ResourcePrefix, the domain names and either CidrBlock or Existing are required;
+// everything else defaults to the behavior described on the field.
+type VpcArgs struct {
+	// ResourcePrefix is prepended to the name of every resource
+	ResourcePrefix string
+
+	// CidrBlock is the IPv4 block of the VPC. Ignored when adopting an existing VPC.
+	CidrBlock string
+	// Ipam allocates the IPv4 block from an IPAM pool instead of CidrBlock
+	Ipam *IpamArgs
+	// EnableIpv6 requests an Amazon-provided IPv6 /56 and gives every subnet a /64 of it
+	EnableIpv6 bool
+
+	Subnets           SubnetArgs
+	AvailabilityZones AvailabilityZoneArgs
+	Nat               NatArgs
+	NetworkAcls       NetworkAclArgs
+	// KeepVpcDefaults leaves the rules of the VPC's default security group and network ACL alone. Stripping them
+	// needs NetworkAcls, or the subnets that still use the default network ACL would be cut off.
+	KeepVpcDefaults bool
+
+	// Existing adopts a VPC managed elsewhere instead of creating one
+	Existing *ExistingVpcArgs
+
+	// TransitGateway and Peerings connect the VPC to other networks, such as internal artifact mirrors
+	TransitGateway *TransitGatewayArgs
+	Peerings       []PeeringArgs
+
+	// GatewayEndpoints lists the services (s3, dynamodb) to create gateway endpoints for
+	GatewayEndpoints []string
+	// InterfaceEndpoints lists the services (ssm, logs, sts, ...) to create interface endpoints for
+	InterfaceEndpoints []string
+
+	FlowLogs FlowLogArgs
+
+	// EnableElastiCacheSubnetGroup adds an ElastiCache subnet group next to the RDS one for the database tier
+	EnableElastiCacheSubnetGroup bool
+
+	PrivateDomainName string
+	PublicDomainName  string
+	PublicZone        PublicZoneArgs
+
+	// DhcpOptions applies to a created VPC only; an adopted VPC keeps its own DHCP options
+	DhcpOptions DhcpOptionsArgs
+	// ResolverRules forward queries for other domains, such as corporate ones, out of the VPC
+	ResolverRules []ResolverRuleArgs
+
+	// Debug makes buckets and zones deletable even when they still hold data
+	Debug bool
+}
+
+// IpamArgs allocates the VPC's IPv4 block from an AWS VPC IPAM pool. Its subnets must then be carved, as their blocks
+// are only known once the VPC has been allocated.
+type IpamArgs struct {
+	PoolID        string
+	NetmaskLength int
+}
+
+// SubnetArgs lays out the subnet tiers. Either list the CIDRs explicitly or set PrefixLength to have them carved out
+// of the VPC's CidrBlock.
+type SubnetArgs struct {
+	PublicCidrs   []string
+	PrivateCidrs  []string
+	DatabaseCidrs []string
+
+	// PrefixLength is the size of carved subnets
+	PrefixLength int
+	// PerAz is how many carved subnets each tier gets in every AZ, by default 1
+	PerAz int
+	// EnableDatabase carves a database tier as well
+	EnableDatabase bool
+}
+
+// AvailabilityZoneArgs selects the AZs subnets are placed in, see resolveAvailabilityZones.
+type AvailabilityZoneArgs struct {
+	Allow   []string
+	Exclude []string
+	// Max is how many AZs subnets are spread over, and carved subnets are laid out for
+	Max int
+}
+
+// NatArgs picks how private subnets reach the IPv4 internet.
+type NatArgs struct {
+	// Strategy is one of the NatStrategy* constants, by default NatStrategyPerAz
+	Strategy string
+
+	// Settings for NatStrategyInstance, by default the latest arm64 fck-nat image on a t4g.nano. The instance type
+	// defaults to a t3.nano for x86_64.
+	InstanceType         string
+	InstanceArchitecture string
+	InstanceAmi          string
+}
+
+// ExistingVpcArgs identifies a VPC to adopt. Each tier's subnets are given by ID, or else by tags; see adoptVpc.
+type ExistingVpcArgs struct {
+	VpcID string
+
+	PublicSubnetIDs   []string
+	PrivateSubnetIDs  []string
+	DatabaseSubnetIDs []string
+
+	PublicSubnetTags   map[string]string
+	PrivateSubnetTags  map[string]string
+	DatabaseSubnetTags map[string]string
+}
+
+// FlowLogArgs turns on VPC flow logs when Destination is set.
+type FlowLogArgs struct {
+	// Destination is FlowLogsToCloudWatch, FlowLogsToS3 or empty for no flow logs
+	Destination string
+	// TrafficType is ACCEPT, REJECT or ALL (the default)
+	TrafficType string
+	// Format is a custom log format, by default AWS's default format
+	Format string
+
+	// RetentionDays applies to CloudWatch, by default 30
+	RetentionDays int
+	// S3ExpirationDays applies to S3, by default 365
+	S3ExpirationDays int
+	// S3TransitionDays moves S3 logs to STANDARD_IA after that many days when set
+	S3TransitionDays int
+}
+
+// PublicZoneArgs picks where the public hosted zone comes from.
+type PublicZoneArgs struct {
+	// Mode is PublicZoneLookup (the default) or PublicZoneCreate
+	Mode string
+
+	// DelegateToParent writes NS records for a created zone into its parent zone
+	DelegateToParent bool
+	// ParentZoneID or ParentDomainName find the parent zone. The default is PublicDomainName minus its first label.
+	ParentZoneID     string
+	ParentDomainName string
+	// ParentZoneRoleArn or ParentZoneProfile reach a parent zone in another account
+	ParentZoneRoleArn string
+	ParentZoneProfile string
+	// ParentZoneRegion is the region to reach the parent zone's account through, the stack's region by default
+	ParentZoneRegion string
+
+	// EnableDnssec signs the public zone, see enableDnssec
+	EnableDnssec bool
+}
+
+// Vpc is the network a COPR cluster runs in: the VPC with its subnet tiers, gateways and route tables, the optional
+// endpoints and flow logs, and the public and private hosted zones. Outputs that do not apply to the chosen options
+// are empty.
+type Vpc struct {
+	pulumi.ResourceState
+
+	VpcID             pulumi.StringOutput
+	CidrBlock         pulumi.StringOutput
+	Ipv6CidrBlock     pulumi.StringOutput
+	AvailabilityZones pulumi.StringArrayOutput
+
+	PublicSubnetIDs     pulumi.StringArrayOutput
+	PrivateSubnetIDs    pulumi.StringArrayOutput
+	DatabaseSubnetIDs   pulumi.StringArrayOutput
+	PublicSubnetsByAz   pulumi.StringArrayMapOutput
+	PrivateSubnetsByAz  pulumi.StringArrayMapOutput
+	DatabaseSubnetsByAz pulumi.StringArrayMapOutput
+	// SubnetAZs maps each tier to the AZ of each of its subnets, index for index with the subnet ID lists
+	SubnetAZs pulumi.StringArrayMapOutput
+
+	PublicSubnetIpv6Cidrs  pulumi.StringArrayOutput
+	PrivateSubnetIpv6Cidrs pulumi.StringArrayOutput
+
+	PrivateRouteTableIDs pulumi.StringArrayOutput
+	// PeerCidrs and PeerIpv6Cidrs are the networks reachable through the transit gateway and peering connections
+	PeerCidrs                  pulumi.StringArrayOutput
+	PeerIpv6Cidrs              pulumi.StringArrayOutput
+	TransitGatewayAttachmentID pulumi.StringOutput
+	// VpcPeeringConnectionIDs maps each peer VPC ID to its peering connection
+	VpcPeeringConnectionIDs pulumi.StringMapOutput
+
+	// NetworkAclIDs maps each subnet tier to its network ACL
+	NetworkAclIDs pulumi.StringMapOutput
+
+	NatStrategy   pulumi.StringOutput
+	NatGatewayIDs pulumi.StringArrayOutput
+	NatPublicIPs  pulumi.StringArrayOutput
+	NatInstanceID pulumi.StringOutput
+
+	VpcEndpointIDs             pulumi.StringMapOutput
+	VpcEndpointSecurityGroupID pulumi.StringOutput
+
+	FlowLogID              pulumi.StringOutput
+	FlowLogDestinationArn  pulumi.StringOutput
+	FlowLogDestinationType pulumi.StringOutput
+
+	DbSubnetGroupName          pulumi.StringOutput
+	ElastiCacheSubnetGroupName pulumi.StringOutput
+
+	PublicHostedZoneID          pulumi.StringOutput
+	PublicHostedZoneNameServers pulumi.StringArrayOutput
+	// PublicZoneDsRecord is the DS record to add at the parent zone or registrar once DNSSEC is enabled
+	PublicZoneDsRecord  pulumi.StringOutput
+	PrivateHostedZoneID pulumi.StringOutput
+	PublicDomainName    pulumi.StringOutput
+	PrivateDomainName   pulumi.StringOutput
+
+	DhcpOptionsID      pulumi.StringOutput
+	ResolverEndpointID pulumi.StringOutput
+	// ResolverRuleIDs maps each forwarded domain to its resolver rule
+	ResolverRuleIDs pulumi.StringMapOutput
+
+	stackOutputs pulumi.Map
+}
+
+// NewVpc creates the network described by args, or adopts an existing VPC when args.Existing is set.
+func NewVpc(ctx *pulumi.Context, name string, args *VpcArgs, opts ...pulumi.ResourceOption) (*Vpc, error) {
+	if args == nil {
+		return nil, fmt.Errorf("missing args for network %s", name)
+	}
+	if args.ResourcePrefix == "" || args.PublicDomainName == "" || args.PrivateDomainName == "" {
+		return nil, fmt.Errorf("network %s needs a ResourcePrefix, PublicDomainName and PrivateDomainName", name)
+	}
+	if err := checkFlowLogArgs(args.FlowLogs); err != nil {
+		return nil, err
+	}
+	if args.Existing == nil && !args.KeepVpcDefaults && !args.NetworkAcls.Enable {
+		return nil, fmt.Errorf("network %s would strip the rules of the default network ACL its subnets use: "+
+			"enable the network ACLs or keep the VPC defaults", name)
+	}
+
+	v := &Vpc{}
+	err := ctx.RegisterComponentResource("copr:network:Vpc", name, v, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	// The resources below predate the component and were created without a parent; the alias lets existing stacks
+	// move them under it without replacing anything.
+	childOpts := []pulumi.ResourceOption{
+		pulumi.Parent(v),
+		pulumi.Aliases([]pulumi.Alias{{NoParent: pulumi.Bool(true)}}),
+	}
+
+	empty := pulumi.String("").ToStringOutput()
+	v.NatStrategy = empty
+	v.NatGatewayIDs = pulumi.StringArray{}.ToStringArrayOutput()
+	v.NatPublicIPs = pulumi.StringArray{}.ToStringArrayOutput()
+	v.NatInstanceID = empty
+	v.VpcEndpointSecurityGroupID = empty
+	v.FlowLogID = empty
+	v.FlowLogDestinationArn = empty
+	v.FlowLogDestinationType = empty
+	v.DbSubnetGroupName = empty
+	v.ElastiCacheSubnetGroupName = empty
+	v.PublicHostedZoneNameServers = pulumi.StringArray{}.ToStringArrayOutput()
+	v.PeerCidrs = pulumi.StringArray{}.ToStringArrayOutput()
+	v.PeerIpv6Cidrs = pulumi.StringArray{}.ToStringArrayOutput()
+	v.TransitGatewayAttachmentID = empty
+	v.VpcPeeringConnectionIDs = pulumi.StringMap{}.ToStringMapOutput()
+	v.DhcpOptionsID = empty
+	v.PublicZoneDsRecord = empty
+	v.ResolverEndpointID = empty
+
+	// Either adopt a VPC that someone else manages or build our own. Everything below works the same on both.
+	var network *vpcNetwork
+	if args.Existing != nil {
+		if args.TransitGateway != nil || len(args.Peerings) > 0 {
+			return nil, fmt.Errorf("transit gateway and peering connections can only be managed for a VPC this stack creates")
+		}
+		network, err = adoptVpc(ctx, args.Existing)
+	} else {
+		network, err = createVpc(ctx, v, args, childOpts...)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = createNetworkAcls(ctx, v, args, network, childOpts...); err != nil {
+		return nil, err
+	}
+	if err = createDatabaseSubnetGroups(ctx, v, args, network.DatabaseSubnets, childOpts...); err != nil {
+		return nil, err
+	}
+	if err = createVpcEndpoints(ctx, v, args, network, childOpts...); err != nil {
+		return nil, err
+	}
+	if err = createFlowLogs(ctx, v, args, network.VpcID, childOpts...); err != nil {
+		return nil, err
+	}
+	if err = createHostedZones(ctx, v, args, network.VpcID, childOpts...); err != nil {
+		return nil, err
+	}
+	if err = createResolverRules(ctx, v, args, network, childOpts...); err != nil {
+		return nil, err
+	}
+
+	v.VpcID = network.VpcID
+	v.CidrBlock = network.CidrBlock
+	v.Ipv6CidrBlock = network.Ipv6CidrBlock
+	v.AvailabilityZones = pulumi.ToStringArray(network.AvailabilityZones).ToStringArrayOutput()
+	v.PublicSubnetIDs = subnetIDs(network.PublicSubnets).ToStringArrayOutput()
+	v.PrivateSubnetIDs = subnetIDs(network.PrivateSubnets).ToStringArrayOutput()
+	v.DatabaseSubnetIDs = subnetIDs(network.DatabaseSubnets).ToStringArrayOutput()
+	v.PublicSubnetsByAz = subnetsByAz(network.PublicSubnets).ToStringArrayMapOutput()
+	v.PrivateSubnetsByAz = subnetsByAz(network.PrivateSubnets).ToStringArrayMapOutput()
+	v.DatabaseSubnetsByAz = subnetsByAz(network.DatabaseSubnets).ToStringArrayMapOutput()
+	v.SubnetAZs = pulumi.StringArrayMap{
+		"public":   subnetAZs(network.PublicSubnets),
+		"private":  subnetAZs(network.PrivateSubnets),
+		"database": subnetAZs(network.DatabaseSubnets),
+	}.ToStringArrayMapOutput()
+	v.PublicSubnetIpv6Cidrs = subnetIpv6CIDRs(network.PublicSubnets).ToStringArrayOutput()
+	v.PrivateSubnetIpv6Cidrs = subnetIpv6CIDRs(network.PrivateSubnets).ToStringArrayOutput()
+	v.PrivateRouteTableIDs = network.PrivateRouteTableIDs.ToStringArrayOutput()
+	v.PublicDomainName = pulumi.String(args.PublicDomainName).ToStringOutput()
+	v.PrivateDomainName = pulumi.String(args.PrivateDomainName).ToStringOutput()
+
+	v.stackOutputs = v.buildStackOutputs(args, network)
+	if err = ctx.RegisterResourceOutputs(v, v.stackOutputs); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// StackOutputs returns the outputs a VPC stack publishes for the certs and cluster stacks, keyed by the output names
+// of the outputs package.
+func (v *Vpc) StackOutputs() pulumi.Map {
+	return v.stackOutputs
+}
+
+func (v *Vpc) buildStackOutputs(args *VpcArgs, network *vpcNetwork) pulumi.Map {
+	exports := pulumi.Map{
+		outputs.PublicHostedZoneID:  v.PublicHostedZoneID,
+		outputs.PrivateHostedZoneID: v.PrivateHostedZoneID,
+		outputs.PublicDomainName:    v.PublicDomainName,
+		outputs.PrivateDomainName:   v.PrivateDomainName,
+
+		outputs.VpcID:        v.VpcID,
+		outputs.VpcCidrBlock: v.CidrBlock,
+
+		outputs.PublicSubnets:     v.PublicSubnetIDs,
+		outputs.PublicSubnetsAZs:  v.PublicSubnetsByAz,
+		outputs.PrivateSubnets:    v.PrivateSubnetIDs,
+		outputs.PrivateSubnetsAZs: v.PrivateSubnetsByAz,
+
+		// Which AZ each subnet landed in, index for index with the subnet lists above
+		outputs.AvailabilityZones: v.AvailabilityZones,
+		outputs.SubnetAZs:         v.SubnetAZs,
+
+		outputs.PrivateRouteTableIDs: v.PrivateRouteTableIDs,
+		outputs.VpcEndpointIDs:       v.VpcEndpointIDs,
+	}
+
+	if len(network.DatabaseSubnets) > 0 {
+		exports[outputs.DatabaseSubnets] = v.DatabaseSubnetIDs
+		exports[outputs.DatabaseSubnetsAZs] = v.DatabaseSubnetsByAz
+		exports[outputs.DbSubnetGroupName] = v.DbSubnetGroupName
+		if args.EnableElastiCacheSubnetGroup {
+			exports[outputs.ElastiCacheSubnetGroupName] = v.ElastiCacheSubnetGroupName
+		}
+	}
+
+	if network.Ipv6 {
+		exports[outputs.VpcIpv6CidrBlock] = v.Ipv6CidrBlock
+		exports[outputs.PublicSubnetsIpv6CIDRs] = v.PublicSubnetIpv6Cidrs
+		exports[outputs.PrivateSubnetsIpv6CIDRs] = v.PrivateSubnetIpv6Cidrs
+	}
+
+	if args.Existing == nil {
+		exports[outputs.DhcpOptionsID] = v.DhcpOptionsID
+		exports[outputs.NatStrategy] = v.NatStrategy
+		exports[outputs.NatGatewayIDs] = v.NatGatewayIDs
+		exports[outputs.NatPublicIPs] = v.NatPublicIPs
+		if network.NatInstance {
+			exports[outputs.NatInstanceID] = v.NatInstanceID
+		}
+	}
+
+	if args.TransitGateway != nil || len(args.Peerings) > 0 {
+		exports[outputs.PeerCidrs] = v.PeerCidrs
+		exports[outputs.PeerIpv6Cidrs] = v.PeerIpv6Cidrs
+	}
+	if args.TransitGateway != nil {
+		exports[outputs.TransitGatewayAttachmentID] = v.TransitGatewayAttachmentID
+	}
+	if len(args.Peerings) > 0 {
+		exports[outputs.VpcPeeringConnectionIDs] = v.VpcPeeringConnectionIDs
+	}
+
+	if args.NetworkAcls.Enable {
+		exports[outputs.NetworkAclIDs] = v.NetworkAclIDs
+	}
+
+	if len(args.InterfaceEndpoints) > 0 {
+		exports[outputs.VpcEndpointSecurityGroupID] = v.VpcEndpointSecurityGroupID
+	}
+
+	if args.FlowLogs.Destination != "" {
+		exports[outputs.FlowLogID] = v.FlowLogID
+		exports[outputs.FlowLogDestinationType] = v.FlowLogDestinationType
+		exports[outputs.FlowLogDestinationArn] = v.FlowLogDestinationArn
+	}
+
+	if args.PublicZone.EnableDnssec {
+		exports[outputs.PublicZoneDsRecord] = v.PublicZoneDsRecord
+	}
+
+	if len(args.ResolverRules) > 0 {
+		exports[outputs.ResolverEndpointID] = v.ResolverEndpointID
+		exports[outputs.ResolverRuleIDs] = v.ResolverRuleIDs
+	}
+
+	if args.PublicZone.Mode == PublicZoneCreate {
+		exports[outputs.PublicHostedZoneNameServers] = v.PublicHostedZoneNameServers
+	}
+
+	return exports
+}
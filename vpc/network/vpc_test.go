@@ -0,0 +1,1069 @@
+package network
+
+import (
+	"fmt"
+	"net/netip"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"copr-pulumi-go-aws-outputs"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// registered is a resource as seen by the mock engine.
+type registered struct {
+	typ    string
+	name   string
+	parent string
+	inputs resource.PropertyMap
+	// dependsOn are the URNs of the resource's explicit dependencies
+	dependsOn []string
+}
+
+// mocks records every resource registered and answers the provider functions the component calls.
+type mocks struct {
+	mu        sync.Mutex
+	resources []registered
+	// region is the stack's region, us-east-1 unless set
+	region string
+}
+
+func (m *mocks) NewResource(args pulumi.MockResourceArgs) (string, resource.PropertyMap, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.resources = append(m.resources, registered{
+		typ:       args.TypeToken,
+		name:      args.Name,
+		parent:    args.RegisterRPC.GetParent(),
+		inputs:    args.Inputs,
+		dependsOn: args.RegisterRPC.GetDependencies(),
+	})
+	state := args.Inputs.Copy()
+	if args.TypeToken == "aws:ec2/vpc:Vpc" && state.HasValue("ipv4IpamPoolId") {
+		state["cidrBlock"] = resource.NewStringProperty("10.42.0.0/16")
+	}
+	if args.TypeToken == "aws:ec2/vpc:Vpc" && state["assignGeneratedIpv6CidrBlock"].IsBool() &&
+		state["assignGeneratedIpv6CidrBlock"].BoolValue() {
+		state["ipv6CidrBlock"] = resource.NewStringProperty("2600:1f18:c0f:ab00::/56")
+	}
+	return args.Name + "-id", state, nil
+}
+
+func (m *mocks) Call(args pulumi.MockCallArgs) (resource.PropertyMap, error) {
+	outputs := args.Args.Copy()
+	switch args.Token {
+	case "aws:index/getAvailabilityZones:getAvailabilityZones":
+		outputs["names"] = resource.NewPropertyValue([]interface{}{"us-east-1a", "us-east-1b", "us-east-1c", "us-east-1d"})
+	case "aws:index/getRegion:getRegion":
+		region := m.region
+		if region == "" {
+			region = "us-east-1"
+		}
+		outputs["name"] = resource.NewStringProperty(region)
+	case "aws:route53/getZone:getZone":
+		outputs["zoneId"] = resource.NewStringProperty("Z0PUBLIC")
+	case "aws:index/getCallerIdentity:getCallerIdentity":
+		outputs["accountId"] = resource.NewStringProperty("123456789012")
+	case "aws:ec2/getAmi:getAmi":
+		outputs["id"] = resource.NewStringProperty("ami-0fcknat")
+	}
+	return outputs, nil
+}
+
+func (m *mocks) count(typ string) int {
+	n := 0
+	for _, r := range m.resources {
+		if r.typ == typ {
+			n++
+		}
+	}
+	return n
+}
+
+func (m *mocks) inputs(typ string) []resource.PropertyMap {
+	var inputs []resource.PropertyMap
+	for _, r := range m.resources {
+		if r.typ == typ {
+			inputs = append(inputs, r.inputs)
+		}
+	}
+	return inputs
+}
+
+func (m *mocks) names(typ string) []string {
+	var names []string
+	for _, r := range m.resources {
+		if r.typ == typ {
+			names = append(names, r.name)
+		}
+	}
+	return names
+}
+
+func testArgs() *VpcArgs {
+	return &VpcArgs{
+		ResourcePrefix: "test-",
+		CidrBlock:      "10.0.0.0/16",
+		Subnets: SubnetArgs{
+			PublicCidrs:  []string{"10.0.0.0/24", "10.0.1.0/24", "10.0.2.0/24"},
+			PrivateCidrs: []string{"10.0.64.0/24", "10.0.65.0/24", "10.0.66.0/24"},
+		},
+		PrivateDomainName: "copr.internal",
+		PublicDomainName:  "copr.example.com",
+		// Stripping the VPC defaults needs the network ACLs, which most tests leave off
+		KeepVpcDefaults: true,
+	}
+}
+
+// newTestVpc runs NewVpc against the mock engine and returns the component along with the mocks.
+func newTestVpc(t *testing.T, args *VpcArgs) (*Vpc, *mocks, error) {
+	t.Helper()
+	return newTestVpcWithMocks(t, args, &mocks{})
+}
+
+func newTestVpcWithMocks(t *testing.T, args *VpcArgs, m *mocks) (*Vpc, *mocks, error) {
+	t.Helper()
+	var vpc *Vpc
+	err := pulumi.RunErr(func(ctx *pulumi.Context) error {
+		var err error
+		vpc, err = NewVpc(ctx, "test-network", args)
+		return err
+	}, pulumi.WithMocks("copr-pulumi-go-aws-vpc", "test", m))
+	return vpc, m, err
+}
+
+func TestNatStrategy(t *testing.T) {
+	tests := []struct {
+		strategy     string
+		natGateways  int
+		natInstances int
+	}{
+		{"", 3, 0},
+		{NatStrategyPerAz, 3, 0},
+		{NatStrategySingle, 1, 0},
+		{NatStrategyInstance, 0, 1},
+		{NatStrategyNone, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			args := testArgs()
+			args.Nat.Strategy = tt.strategy
+			_, m, err := newTestVpc(t, args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := m.count("aws:ec2/natGateway:NatGateway"); got != tt.natGateways {
+				t.Errorf("got %d NAT gateways, want %d", got, tt.natGateways)
+			}
+			if got := m.count("aws:ec2/instance:Instance"); got != tt.natInstances {
+				t.Errorf("got %d NAT instances, want %d", got, tt.natInstances)
+			}
+			// Private route tables are per AZ whatever the strategy
+			if got := m.count("aws:ec2/routeTable:RouteTable"); got != 4 {
+				t.Errorf("got %d route tables, want 1 public and 3 private", got)
+			}
+		})
+	}
+}
+
+func TestNatInstanceType(t *testing.T) {
+	for _, tt := range []struct {
+		arch, instanceType, want string
+	}{
+		{"", "", "t4g.nano"},
+		{"x86_64", "", "t3.nano"},
+		{"x86_64", "c6i.large", "c6i.large"},
+	} {
+		args := testArgs()
+		args.Nat = NatArgs{Strategy: NatStrategyInstance, InstanceArchitecture: tt.arch, InstanceType: tt.instanceType}
+		_, m, err := newTestVpc(t, args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		instances := m.inputs("aws:ec2/instance:Instance")
+		if len(instances) != 1 || instances[0]["instanceType"].StringValue() != tt.want {
+			t.Errorf("NAT instance for %q %q = %v, want a %s", tt.arch, tt.instanceType, instances, tt.want)
+		}
+	}
+
+	args := testArgs()
+	args.Nat = NatArgs{Strategy: NatStrategyInstance, InstanceArchitecture: "ppc64le"}
+	if _, _, err := newTestVpc(t, args); err == nil || !strings.Contains(err.Error(), "unknown NAT instance architecture") {
+		t.Fatalf("NewVpc() error = %v, want an unknown architecture", err)
+	}
+}
+
+func TestUnknownNatStrategy(t *testing.T) {
+	args := testArgs()
+	args.Nat.Strategy = "gateway"
+	if _, _, err := newTestVpc(t, args); err == nil || !strings.Contains(err.Error(), "unknown NAT strategy") {
+		t.Fatalf("NewVpc() error = %v, want an unknown NAT strategy", err)
+	}
+}
+
+func TestOverlappingSubnets(t *testing.T) {
+	args := testArgs()
+	args.Subnets.PrivateCidrs[0] = "10.0.1.0/24"
+	if _, _, err := newTestVpc(t, args); err == nil || !strings.Contains(err.Error(), "overlaps") {
+		t.Fatalf("NewVpc() error = %v, want an overlap", err)
+	}
+}
+
+func TestCarvedSubnetsPerAz(t *testing.T) {
+	args := testArgs()
+	args.Subnets = SubnetArgs{PrefixLength: 24, PerAz: 2, EnableDatabase: true}
+	args.AvailabilityZones.Max = 3
+	vpc, m, err := newTestVpc(t, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first 3 AZs by name, 2 subnets each in 3 tiers
+	if got := m.count("aws:ec2/subnet:Subnet"); got != 18 {
+		t.Errorf("got %d subnets, want 18", got)
+	}
+	names := strings.Join(m.names("aws:ec2/subnet:Subnet"), " ")
+	for _, want := range []string{
+		"test-public-subnet-us-east-1a",
+		"test-public-subnet-us-east-1a-2",
+		"test-private-subnet-us-east-1c-2",
+		"test-database-subnet-us-east-1b",
+	} {
+		if !strings.Contains(names+" ", want+" ") {
+			t.Errorf("no subnet named %s in %s", want, names)
+		}
+	}
+
+	outputs := vpc.StackOutputs()
+	for _, key := range []string{"databaseSubnets", "databaseSubnetsAZs", "dbSubnetGroupName"} {
+		if _, ok := outputs[key]; !ok {
+			t.Errorf("stack outputs are missing %s", key)
+		}
+	}
+}
+
+func TestAvailabilityZones(t *testing.T) {
+	// Without an AZ selection subnets stay on the region's AZs back to front, where stacks always had them
+	_, m, err := newTestVpc(t, testArgs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	subnetAZs := func(m *mocks, tier string) string {
+		var azs []string
+		for _, subnet := range m.inputs("aws:ec2/subnet:Subnet") {
+			if strings.HasPrefix(subnet["tags"].ObjectValue()["Name"].StringValue(), "test-"+tier+"-") {
+				azs = append(azs, subnet["cidrBlock"].StringValue()+" "+subnet["availabilityZone"].StringValue())
+			}
+		}
+		sort.Strings(azs)
+		return strings.Join(azs, ", ")
+	}
+	want := "10.0.0.0/24 us-east-1d, 10.0.1.0/24 us-east-1c, 10.0.2.0/24 us-east-1b"
+	if got := subnetAZs(m, "public"); got != want {
+		t.Errorf("got public subnets %s, want %s", got, want)
+	}
+
+	args := testArgs()
+	args.AvailabilityZones = AvailabilityZoneArgs{Allow: []string{"us-east-1b", "us-east-1a"}}
+	_, m, err = newTestVpc(t, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = "10.0.0.0/24 us-east-1b, 10.0.1.0/24 us-east-1a, 10.0.2.0/24 us-east-1b"
+	if got := subnetAZs(m, "public"); got != want {
+		t.Errorf("got public subnets %s, want %s", got, want)
+	}
+	names := strings.Join(m.names("aws:ec2/subnet:Subnet"), " ") + " "
+	if !strings.Contains(names, "test-public-subnet-us-east-1b-2 ") {
+		t.Errorf("no second public subnet in us-east-1b in %s", names)
+	}
+
+	args = testArgs()
+	args.Subnets = SubnetArgs{PrefixLength: 24}
+	args.AvailabilityZones.Max = 5
+	if _, _, err := newTestVpc(t, args); err == nil || !strings.Contains(err.Error(), "only 4 are left") {
+		t.Errorf("NewVpc() error = %v, want too few AZs", err)
+	}
+}
+
+func TestStackOutputs(t *testing.T) {
+	vpc, _, err := newTestVpc(t, testArgs())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outputs := vpc.StackOutputs()
+	for _, key := range []string{
+		"vpcId", "publicSubnets", "privateSubnets", "publicSubnetsAZs", "privateSubnetsAZs",
+		"publicHostedZoneId", "privateHostedZoneId", "publicDomainName", "privateDomainName",
+		"natStrategy", "natGatewayIds", "natPublicIps",
+	} {
+		if _, ok := outputs[key]; !ok {
+			t.Errorf("stack outputs are missing %s", key)
+		}
+	}
+	// Outputs of features that are off are left out rather than exported empty
+	for _, key := range []string{"databaseSubnets", "vpcIpv6CidrBlock", "flowLogId", "natInstanceId"} {
+		if _, ok := outputs[key]; ok {
+			t.Errorf("stack outputs have %s although it is not enabled", key)
+		}
+	}
+}
+
+// TestStackOutputsContract checks that the stack exports exactly the outputs the other stacks are told to expect.
+func TestStackOutputsContract(t *testing.T) {
+	exported := func(args *VpcArgs) map[string]bool {
+		t.Helper()
+		vpc, _, err := newTestVpc(t, args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys := map[string]bool{}
+		for key := range vpc.StackOutputs() {
+			keys[key] = true
+		}
+		return keys
+	}
+
+	keys := exported(testArgs())
+	for _, key := range outputs.RequiredKeys(outputs.VPC{}) {
+		if !keys[key] {
+			t.Errorf("stack outputs are missing the required %s", key)
+		}
+	}
+
+	// With every feature on, every output of the contract is exported and nothing else
+	args := testArgs()
+	args.EnableIpv6 = true
+	args.Subnets.DatabaseCidrs = []string{"10.0.128.0/24", "10.0.129.0/24"}
+	args.EnableElastiCacheSubnetGroup = true
+	args.Nat.Strategy = NatStrategyInstance
+	args.NetworkAcls.Enable = true
+	args.TransitGateway = &TransitGatewayArgs{ID: "tgw-0mirrors", RouteCidrs: []string{"10.20.0.0/16"}}
+	args.Peerings = []PeeringArgs{{VpcID: "vpc-0peer", Cidrs: []string{"10.30.0.0/16"}}}
+	args.InterfaceEndpoints = []string{"ssm"}
+	args.FlowLogs.Destination = FlowLogsToS3
+	args.PublicZone.Mode = PublicZoneCreate
+	args.PublicZone.EnableDnssec = true
+	args.ResolverRules = []ResolverRuleArgs{{DomainName: "corp.example.com", TargetIps: []string{"192.0.2.10"}}}
+	keys = exported(args)
+	contract := map[string]bool{}
+	for _, key := range outputs.Keys(outputs.VPC{}) {
+		contract[key] = true
+		if !keys[key] {
+			t.Errorf("stack outputs are missing %s", key)
+		}
+	}
+	for key := range keys {
+		if !contract[key] {
+			t.Errorf("stack output %s is not in the outputs contract", key)
+		}
+	}
+}
+
+func TestFlowLogsToS3(t *testing.T) {
+	args := testArgs()
+	args.FlowLogs = FlowLogArgs{Destination: FlowLogsToS3, S3TransitionDays: 30, S3ExpirationDays: 90}
+	_, m, err := newTestVpc(t, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Delivery fails until the bucket policy allows it
+	var dependsOn []string
+	for _, r := range m.resources {
+		if r.typ == "aws:ec2/flowLog:FlowLog" {
+			dependsOn = r.dependsOn
+		}
+	}
+	if !strings.Contains(strings.Join(dependsOn, " "), "aws:s3/bucketPolicy:BucketPolicy::test-flow-log-bucket-policy") {
+		t.Errorf("the flow log depends on %v, want the bucket policy", dependsOn)
+	}
+
+	for _, tt := range []struct {
+		transitionDays, expirationDays int
+		want                           string
+	}{
+		{10, 0, "at least 30 days"},
+		{400, 0, "expire after 365"},
+		{30, 30, "expire after 30"},
+		{0, -1, "cannot expire"},
+	} {
+		args.FlowLogs.S3TransitionDays = tt.transitionDays
+		args.FlowLogs.S3ExpirationDays = tt.expirationDays
+		_, m, err := newTestVpc(t, args)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("NewVpc() with transition after %d and expiration after %d days error = %v, want %q",
+				tt.transitionDays, tt.expirationDays, err, tt.want)
+		}
+		if len(m.resources) != 0 {
+			t.Errorf("created %d resources before rejecting the flow log lifecycle", len(m.resources))
+		}
+	}
+}
+
+func TestVpcEndpoints(t *testing.T) {
+	args := testArgs()
+	args.GatewayEndpoints = []string{"s3", "dynamodb"}
+	args.InterfaceEndpoints = []string{"ssm", "logs"}
+	m := &mocks{}
+	var endpointIDs map[string]string
+	// The IDs are applied on outputs that are known up front, which the run does not wait for
+	done := make(chan struct{})
+	err := pulumi.RunErr(func(ctx *pulumi.Context) error {
+		vpc, err := NewVpc(ctx, "test-network", args)
+		if err != nil {
+			return err
+		}
+		vpc.StackOutputs()[outputs.VpcEndpointIDs].(pulumi.StringMapOutput).ApplyT(func(ids map[string]string) error {
+			endpointIDs = ids
+			close(done)
+			return nil
+		})
+		return nil
+	}, pulumi.WithMocks("copr-pulumi-go-aws-vpc", "test", m))
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the endpoint IDs were never resolved")
+	}
+
+	var privateRouteTables []string
+	for _, name := range m.names("aws:ec2/routeTable:RouteTable") {
+		if strings.HasPrefix(name, "test-private-") {
+			privateRouteTables = append(privateRouteTables, name+"-id")
+		}
+	}
+	sort.Strings(privateRouteTables)
+	for _, endpoint := range m.inputs("aws:ec2/vpcEndpoint:VpcEndpoint") {
+		service := endpoint["serviceName"].StringValue()
+		switch endpoint["vpcEndpointType"].StringValue() {
+		case "Gateway":
+			var routeTables []string
+			for _, id := range endpoint["routeTableIds"].ArrayValue() {
+				routeTables = append(routeTables, id.StringValue())
+			}
+			sort.Strings(routeTables)
+			if !reflect.DeepEqual(routeTables, privateRouteTables) {
+				t.Errorf("gateway endpoint %s is attached to %v, want every private route table %v",
+					service, routeTables, privateRouteTables)
+			}
+		case "Interface":
+			if groups := endpoint["securityGroupIds"].ArrayValue(); len(groups) != 1 ||
+				groups[0].StringValue() != "test-vpce-sg-id" {
+				t.Errorf("interface endpoint %s has security groups %v, want the endpoint group", service, groups)
+			}
+			if got := len(endpoint["subnetIds"].ArrayValue()); got != 3 {
+				t.Errorf("interface endpoint %s is in %d subnets, want one per AZ", service, got)
+			}
+		}
+	}
+	if len(privateRouteTables) != 3 || m.count("aws:ec2/vpcEndpoint:VpcEndpoint") != 4 {
+		t.Errorf("got %d endpoints and private route tables %v", m.count("aws:ec2/vpcEndpoint:VpcEndpoint"),
+			privateRouteTables)
+	}
+	want := map[string]string{
+		"s3":       "test-vpce-s3-id",
+		"dynamodb": "test-vpce-dynamodb-id",
+		"ssm":      "test-vpce-ssm-id",
+		"logs":     "test-vpce-logs-id",
+	}
+	if !reflect.DeepEqual(endpointIDs, want) {
+		t.Errorf("exported endpoint IDs %v, want %v", endpointIDs, want)
+	}
+
+	// S3 can be an endpoint of either kind, but not of both
+	args.InterfaceEndpoints = []string{"ssm", "s3"}
+	_, m, err = newTestVpc(t, args)
+	if err == nil || !strings.Contains(err.Error(), `"s3" is listed as a gateway endpoint already`) {
+		t.Errorf("NewVpc() error = %v, want s3 listed twice", err)
+	}
+	if got := m.count("aws:ec2/vpcEndpoint:VpcEndpoint"); got != 0 {
+		t.Errorf("created %d endpoints before rejecting the lists", got)
+	}
+}
+
+func TestChildrenAreParented(t *testing.T) {
+	args := testArgs()
+	args.Nat.Strategy = NatStrategyInstance
+	args.InterfaceEndpoints = []string{"ssm"}
+	args.GatewayEndpoints = []string{"s3"}
+	args.FlowLogs.Destination = FlowLogsToS3
+	_, m, err := newTestVpc(t, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var componentURN string
+	for _, r := range m.resources {
+		if r.typ == "copr:network:Vpc" {
+			componentURN = "urn:pulumi:test::copr-pulumi-go-aws-vpc::copr:network:Vpc::" + r.name
+		}
+	}
+	if componentURN == "" {
+		t.Fatal("the component was not registered")
+	}
+	for _, r := range m.resources {
+		if r.typ != "copr:network:Vpc" && r.parent != componentURN {
+			t.Errorf("%s %s has parent %q, want the component", r.typ, r.name, r.parent)
+		}
+	}
+}
+
+func TestDatabaseSubnetGroups(t *testing.T) {
+	args := testArgs()
+	args.Subnets.DatabaseCidrs = []string{"10.0.128.0/24", "10.0.129.0/24"}
+	args.EnableElastiCacheSubnetGroup = true
+	_, m, err := newTestVpc(t, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.count("aws:rds/subnetGroup:SubnetGroup") != 1 || m.count("aws:elasticache/subnetGroup:SubnetGroup") != 1 {
+		t.Error("the database tier did not get its subnet groups")
+	}
+
+	// RDS only takes subnet groups that span 2 AZs
+	args.Subnets.DatabaseCidrs = []string{"10.0.128.0/24"}
+	if _, _, err := newTestVpc(t, args); err == nil || !strings.Contains(err.Error(), "all in us-east-1d") {
+		t.Errorf("NewVpc() error = %v, want a single AZ database tier", err)
+	}
+	args.Subnets = SubnetArgs{PrefixLength: 24, EnableDatabase: true}
+	args.AvailabilityZones.Max = 1
+	if _, _, err := newTestVpc(t, args); err == nil || !strings.Contains(err.Error(), "at least 2 availability zones") {
+		t.Errorf("NewVpc() error = %v, want a single AZ database tier", err)
+	}
+}
+
+func TestNetworkAcls(t *testing.T) {
+	args := testArgs()
+	args.Subnets.DatabaseCidrs = []string{"10.0.128.0/24", "10.0.129.0/24"}
+	args.NetworkAcls.Enable = true
+	args.NetworkAcls.Ingress = map[string][]NetworkAclRule{
+		"private": {{Protocol: "tcp", FromPort: 22, ToPort: 22, Cidr: "192.0.2.0/24"}},
+	}
+	vpc, m, err := newTestVpc(t, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := m.names("aws:ec2/networkAcl:NetworkAcl")
+	sort.Strings(got)
+	if strings.Join(got, " ") != "test-database-nacl test-private-nacl test-public-nacl" {
+		t.Errorf("got network ACLs %v, want one per tier", got)
+	}
+	if _, ok := vpc.StackOutputs()["networkAclIds"]; !ok {
+		t.Error("stack outputs are missing networkAclIds")
+	}
+
+	args.NetworkAcls.Ingress = map[string][]NetworkAclRule{"bastion": nil}
+	if _, _, err := newTestVpc(t, args); err == nil || !strings.Contains(err.Error(), "unknown tier") {
+		t.Fatalf("NewVpc() error = %v, want an unknown tier", err)
+	}
+
+	echoRequest := 8
+	for _, rule := range []NetworkAclRule{
+		{Protocol: "gre", Cidr: "192.0.2.0/24"},
+		{Protocol: "tcp", FromPort: 22, ToPort: 22, IcmpType: &echoRequest, Cidr: "192.0.2.0/24"},
+	} {
+		args.NetworkAcls.Ingress = map[string][]NetworkAclRule{"private": {rule}}
+		if _, _, err := newTestVpc(t, args); err == nil || !strings.Contains(err.Error(), "rule 1") {
+			t.Errorf("NewVpc() with rule %+v error = %v, want an invalid rule", rule, err)
+		}
+	}
+}
+
+func TestIpv6SubnetBlock(t *testing.T) {
+	const vpcBlock = "2600:1f18:c0f:ab00::/56"
+	for _, tt := range []struct {
+		tier, index int
+		want        string
+	}{
+		{publicTier, 0, "2600:1f18:c0f:ab00::/64"},
+		{publicTier, 1, "2600:1f18:c0f:ab01::/64"},
+		{privateTier, 0, "2600:1f18:c0f:ab40::/64"},
+		{privateTier, 2, "2600:1f18:c0f:ab42::/64"},
+		{databaseTier, 63, "2600:1f18:c0f:abbf::/64"},
+		{3, 0, "2600:1f18:c0f:abc0::/64"},
+	} {
+		if got, err := ipv6SubnetBlock(vpcBlock, tt.tier, tt.index); err != nil || got != tt.want {
+			t.Errorf("ipv6SubnetBlock(tier %d, index %d) = %s, %v, want %s", tt.tier, tt.index, got, err, tt.want)
+		}
+	}
+	if _, err := ipv6SubnetBlock(vpcBlock, privateTier, maxIpv6SubnetsPerTier); err == nil {
+		t.Errorf("ipv6SubnetBlock() found room for /64 number %d of a tier", maxIpv6SubnetsPerTier)
+	}
+}
+
+func TestDualStack(t *testing.T) {
+	args := testArgs()
+	args.EnableIpv6 = true
+	_, m, err := newTestVpc(t, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var blocks []string
+	for _, subnet := range m.inputs("aws:ec2/subnet:Subnet") {
+		blocks = append(blocks, subnet["ipv6CidrBlock"].StringValue())
+	}
+	sort.Strings(blocks)
+	want := []string{
+		"2600:1f18:c0f:ab00::/64", "2600:1f18:c0f:ab01::/64", "2600:1f18:c0f:ab02::/64",
+		"2600:1f18:c0f:ab40::/64", "2600:1f18:c0f:ab41::/64", "2600:1f18:c0f:ab42::/64",
+	}
+	if !reflect.DeepEqual(blocks, want) {
+		t.Errorf("got subnet IPv6 blocks %v, want %v", blocks, want)
+	}
+
+	// The public subnets reach the IPv6 internet through the internet gateway, the private ones only out of it
+	if got := m.count("aws:ec2/routeTable:RouteTable"); got != 4 {
+		t.Errorf("got %d route tables, want 1 public and 3 private", got)
+	}
+	for _, r := range m.resources {
+		if r.typ != "aws:ec2/routeTable:RouteTable" {
+			continue
+		}
+		var targets []string
+		for _, route := range r.inputs["routes"].ArrayValue() {
+			if route := route.ObjectValue(); route.HasValue("ipv6CidrBlock") && route["ipv6CidrBlock"].StringValue() == "::/0" {
+				for _, key := range []resource.PropertyKey{"gatewayId", "egressOnlyGatewayId"} {
+					if route.HasValue(key) {
+						targets = append(targets, route[key].StringValue())
+					}
+				}
+			}
+		}
+		want := "test-eigw-id"
+		if r.name == "test-public-rt" {
+			want = "test-igw-id"
+		}
+		if len(targets) != 1 || targets[0] != want {
+			t.Errorf("route table %s sends ::/0 to %v, want %s", r.name, targets, want)
+		}
+	}
+
+	args.Subnets = SubnetArgs{PrefixLength: 28, PerAz: 17}
+	if _, _, err := newTestVpc(t, args); err == nil || !strings.Contains(err.Error(), "has 68 subnets, but only 64") {
+		t.Errorf("NewVpc() error = %v, want too many subnets for the tier's IPv6 block", err)
+	}
+}
+
+func TestNetworkAclsDualStack(t *testing.T) {
+	echoRequest := 8
+	args := testArgs()
+	args.EnableIpv6 = true
+	args.NetworkAcls.Enable = true
+	args.NetworkAcls.Ingress = map[string][]NetworkAclRule{
+		"private": {
+			{Protocol: "tcp", FromPort: 22, ToPort: 22, Cidr: "192.0.2.0/24"},
+			{Protocol: "tcp", FromPort: 8443, ToPort: 8443, Cidr: "0.0.0.0/0"},
+			{Protocol: "icmp", Cidr: "0.0.0.0/0"},
+			{Protocol: "icmp", IcmpType: &echoRequest, Cidr: "198.51.100.0/24"},
+			{Protocol: "icmp", IcmpType: &echoRequest, Cidr: "0.0.0.0/0"},
+		},
+	}
+	_, m, err := newTestVpc(t, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var configured []string
+	for _, acl := range m.inputs("aws:ec2/networkAcl:NetworkAcl") {
+		if acl["tags"].ObjectValue()["Name"].StringValue() != "test-private-nacl" {
+			continue
+		}
+		for _, entry := range acl["ingress"].ArrayValue() {
+			e := entry.ObjectValue()
+			ruleNo := int(e["ruleNo"].NumberValue())
+			if ruleNo < networkAclConfiguredRules || ruleNo >= networkAclEphemeralRules {
+				continue
+			}
+			source := e["cidrBlock"]
+			if !source.IsString() {
+				source = e["ipv6CidrBlock"]
+			}
+			rule := fmt.Sprintf("%d %s %s", ruleNo, e["protocol"].StringValue(), source.StringValue())
+			if e["protocol"].StringValue() == icmpProtocol || e["protocol"].StringValue() == icmpv6Protocol {
+				rule += fmt.Sprintf(" type %v", e["icmpType"].NumberValue())
+			} else {
+				rule += fmt.Sprintf(" port %v", e["fromPort"].NumberValue())
+			}
+			configured = append(configured, rule)
+		}
+	}
+	sort.Strings(configured)
+	// The rules from anywhere get an IPv6 twin, ICMP as ICMPv6, except for the one for a particular ICMP type
+	want := []string{
+		"200 tcp 192.0.2.0/24 port 22",
+		"201 tcp 0.0.0.0/0 port 8443",
+		"202 1 0.0.0.0/0 type -1",
+		"203 1 198.51.100.0/24 type 8",
+		"204 1 0.0.0.0/0 type 8",
+		"205 tcp ::/0 port 8443",
+		"206 58 ::/0 type -1",
+	}
+	if strings.Join(configured, ", ") != strings.Join(want, ", ") {
+		t.Errorf("got private ACL rules\n%s\nwant\n%s", strings.Join(configured, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestPeerConnections(t *testing.T) {
+	args := testArgs()
+	args.TransitGateway = &TransitGatewayArgs{ID: "tgw-0mirrors", RouteCidrs: []string{"10.20.0.0/16"}}
+	args.Peerings = []PeeringArgs{{VpcID: "vpc-0peer", Cidrs: []string{"10.30.0.0/16", "fd00:30::/56"}}}
+	vpc, m, err := newTestVpc(t, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := m.count("aws:ec2transitgateway/vpcAttachment:VpcAttachment"); got != 1 {
+		t.Errorf("got %d transit gateway attachments, want 1", got)
+	}
+	if got := m.count("aws:ec2/vpcPeeringConnection:VpcPeeringConnection"); got != 1 {
+		t.Errorf("got %d peering connections, want 1", got)
+	}
+	outputs := vpc.StackOutputs()
+	for _, key := range []string{"peerCidrs", "peerIpv6Cidrs", "transitGatewayAttachmentId", "vpcPeeringConnectionIds"} {
+		if _, ok := outputs[key]; !ok {
+			t.Errorf("stack outputs are missing %s", key)
+		}
+	}
+
+	args.Peerings[0].Cidrs = []string{"10.20.0.0/16"}
+	if _, _, err := newTestVpc(t, args); err == nil || !strings.Contains(err.Error(), "overlaps peer CIDR") {
+		t.Fatalf("NewVpc() error = %v, want a CIDR routed twice", err)
+	}
+
+	args.Peerings[0].Cidrs = []string{"10.0.128.0/20"}
+	if _, _, err := newTestVpc(t, args); err == nil || !strings.Contains(err.Error(), "overlaps the VPC CIDR") {
+		t.Fatalf("NewVpc() error = %v, want a peer inside the VPC", err)
+	}
+}
+
+func TestPeeringAcceptance(t *testing.T) {
+	args := testArgs()
+	args.Peerings = []PeeringArgs{
+		{VpcID: "vpc-0local", Cidrs: []string{"10.30.0.0/16"}},
+		{VpcID: "vpc-0region", Region: "eu-west-1", Cidrs: []string{"10.31.0.0/16"}},
+		{VpcID: "vpc-0managed", OwnerID: "210987654321", AccepterRoleArn: "arn:aws:iam::210987654321:role/peering",
+			Cidrs: []string{"10.32.0.0/16"}},
+		{VpcID: "vpc-0pending", OwnerID: "210987654321", Cidrs: []string{"10.33.0.0/16"}},
+		{VpcID: "vpc-0accepted", OwnerID: "210987654321", Accepted: true, Cidrs: []string{"10.34.0.0/16"}},
+	}
+	_, m, err := newTestVpc(t, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accepters := m.names("aws:ec2/vpcPeeringConnectionAccepter:VpcPeeringConnectionAccepter")
+	sort.Strings(accepters)
+	if got := strings.Join(accepters, " "); got != "test-peering-vpc-0managed-accepter test-peering-vpc-0region-accepter" {
+		t.Errorf("got peering accepters %s, want the cross-region and the managed cross-account peering", got)
+	}
+	for _, provider := range m.inputs("pulumi:providers:aws") {
+		if provider.HasValue("assumeRole") {
+			if got := provider["assumeRole"].ObjectValue()["roleArn"].StringValue(); got != args.Peerings[2].AccepterRoleArn {
+				t.Errorf("accepter provider assumes %s, want %s", got, args.Peerings[2].AccepterRoleArn)
+			}
+		} else if got := provider["region"].StringValue(); got != "eu-west-1" {
+			t.Errorf("accepter provider for the cross-region peering is in %q, want eu-west-1", got)
+		}
+	}
+
+	// The connection nobody has accepted yet gets no routes, they would be blackholes. Every route table carries
+	// the same peer routes, so the first one will do.
+	var routed []string
+	for _, rt := range m.inputs("aws:ec2/routeTable:RouteTable") {
+		for _, route := range rt["routes"].ArrayValue() {
+			if r := route.ObjectValue(); r.HasValue("vpcPeeringConnectionId") {
+				routed = append(routed, r["cidrBlock"].StringValue())
+			}
+		}
+		break
+	}
+	sort.Strings(routed)
+	if got := strings.Join(routed, " "); got != "10.30.0.0/16 10.31.0.0/16 10.32.0.0/16 10.34.0.0/16" {
+		t.Errorf("got peering routes to %s, want all but the pending peering", got)
+	}
+}
+
+func TestVpcDefaultsRestricted(t *testing.T) {
+	args := testArgs()
+	args.KeepVpcDefaults = false
+	args.NetworkAcls.Enable = true
+	_, m, err := newTestVpc(t, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.count("aws:ec2/defaultSecurityGroup:DefaultSecurityGroup") != 1 || m.count("aws:ec2/defaultNetworkAcl:DefaultNetworkAcl") != 1 {
+		t.Fatal("the default security group and network ACL were not adopted")
+	}
+	for _, acl := range m.inputs("aws:ec2/defaultNetworkAcl:DefaultNetworkAcl") {
+		for _, key := range []resource.PropertyKey{"ingress", "egress"} {
+			if rules := acl[key]; rules.IsArray() && len(rules.ArrayValue()) > 0 {
+				t.Errorf("the default network ACL kept %s rules %v", key, rules)
+			}
+		}
+	}
+
+	// The subnets would still use the stripped default network ACL
+	args.NetworkAcls.Enable = false
+	if _, _, err = newTestVpc(t, args); err == nil || !strings.Contains(err.Error(), "enable the network ACLs") {
+		t.Errorf("NewVpc() error = %v, want the network ACLs required", err)
+	}
+
+	args.KeepVpcDefaults = true
+	_, m, err = newTestVpc(t, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.count("aws:ec2/defaultSecurityGroup:DefaultSecurityGroup") != 0 || m.count("aws:ec2/defaultNetworkAcl:DefaultNetworkAcl") != 0 {
+		t.Error("the default security group and network ACL were adopted although KeepVpcDefaults is set")
+	}
+}
+
+func TestDhcpOptions(t *testing.T) {
+	args := testArgs()
+	args.DhcpOptions.SearchDomains = []string{"corp.example.com", "lab.example.com"}
+	for region, want := range map[string]string{
+		// us-east-1 names its instances differently from every other region
+		"us-east-1": "copr.internal corp.example.com lab.example.com ec2.internal",
+		"eu-west-1": "copr.internal corp.example.com lab.example.com eu-west-1.compute.internal",
+	} {
+		_, m, err := newTestVpcWithMocks(t, args, &mocks{region: region})
+		if err != nil {
+			t.Fatal(err)
+		}
+		options := m.inputs("aws:ec2/vpcDhcpOptions:VpcDhcpOptions")
+		if len(options) != 1 {
+			t.Fatalf("got %d DHCP options sets, want 1", len(options))
+		}
+		if got := options[0]["domainName"].StringValue(); got != want {
+			t.Errorf("DHCP options in %s search %q, want %q", region, got, want)
+		}
+		if got := options[0]["domainNameServers"].ArrayValue(); len(got) != 1 || got[0].StringValue() != "AmazonProvidedDNS" {
+			t.Errorf("DHCP options use name servers %v, want the Amazon provided DNS", got)
+		}
+
+		associations := m.inputs("aws:ec2/vpcDhcpOptionsAssociation:VpcDhcpOptionsAssociation")
+		if len(associations) != 1 || associations[0]["vpcId"].StringValue() != "test-vpc-id" ||
+			associations[0]["dhcpOptionsId"].StringValue() != "test-dhcp-options-id" {
+			t.Errorf("got DHCP options associations %v, want the options set on the VPC", associations)
+		}
+	}
+
+	// An adopted VPC keeps the DHCP options it has
+	m := &adoptMocks{mocks: &mocks{}}
+	err := pulumi.RunErr(func(ctx *pulumi.Context) error {
+		_, err := NewVpc(ctx, "test-network", adoptArgs())
+		return err
+	}, pulumi.WithMocks("copr-pulumi-go-aws-vpc", "test", m))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := m.count("aws:ec2/vpcDhcpOptions:VpcDhcpOptions"); got != 0 {
+		t.Errorf("got %d DHCP options sets for an adopted VPC", got)
+	}
+}
+
+func TestResolverRules(t *testing.T) {
+	args := testArgs()
+	args.ResolverRules = []ResolverRuleArgs{
+		{DomainName: "corp.example.com", TargetIps: []string{"192.0.2.10", "192.0.2.11:5353"}},
+	}
+	vpc, m, err := newTestVpc(t, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := m.names("aws:route53/resolverRule:ResolverRule"); len(got) != 1 || got[0] != "test-resolver-rule-corp-example-com" {
+		t.Errorf("got resolver rules %v", got)
+	}
+	// tcp and udp for each of the two ports
+	if got := m.count("aws:vpc/securityGroupEgressRule:SecurityGroupEgressRule"); got != 4 {
+		t.Errorf("got %d resolver egress rules, want 4", got)
+	}
+	outputs := vpc.StackOutputs()
+	for _, key := range []string{"dhcpOptionsId", "resolverEndpointId", "resolverRuleIds"} {
+		if _, ok := outputs[key]; !ok {
+			t.Errorf("stack outputs are missing %s", key)
+		}
+	}
+
+	args.ResolverRules[0].TargetIps = []string{"dns.corp.example.com"}
+	if _, _, err := newTestVpc(t, args); err == nil || !strings.Contains(err.Error(), "invalid target") {
+		t.Fatalf("NewVpc() error = %v, want an invalid target", err)
+	}
+}
+
+func TestDnssec(t *testing.T) {
+	args := testArgs()
+	args.PublicZone.EnableDnssec = true
+	vpc, m, err := newTestVpc(t, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, typ := range []string{
+		"aws:kms/key:Key", "aws:route53/keySigningKey:KeySigningKey", "aws:route53/hostedZoneDnsSec:HostedZoneDnsSec",
+	} {
+		if got := m.count(typ); got != 1 {
+			t.Errorf("got %d %s, want 1", got, typ)
+		}
+	}
+	// The mocked region is us-east-1 already, so the key needs no provider of its own
+	if got := m.count("pulumi:providers:aws"); got != 0 {
+		t.Errorf("got %d providers, want none", got)
+	}
+	if _, ok := vpc.StackOutputs()["publicZoneDsRecord"]; !ok {
+		t.Error("stack outputs are missing publicZoneDsRecord")
+	}
+
+	// Elsewhere the key gets a us-east-1 provider, with the same credentials as the rest of the stack
+	t.Setenv(pulumi.EnvConfig, `{
+		"aws:region": "eu-west-1",
+		"aws:profile": "copr",
+		"aws:assumeRole": "{\"roleArn\": \"arn:aws:iam::123456789012:role/copr-deploy\"}"
+	}`)
+	_, m, err = newTestVpcWithMocks(t, args, &mocks{region: "eu-west-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	providers := m.inputs("pulumi:providers:aws")
+	if len(providers) != 1 {
+		t.Fatalf("got %d providers, want 1", len(providers))
+	}
+	provider := providers[0]
+	if got := provider["region"].StringValue(); got != dnssecKeyRegion {
+		t.Errorf("key provider region %s, want %s", got, dnssecKeyRegion)
+	}
+	if got := provider["profile"].StringValue(); got != "copr" {
+		t.Errorf("key provider profile %q, want the stack's copr", got)
+	}
+	if got := provider["assumeRole"].ObjectValue()["roleArn"].StringValue(); got != "arn:aws:iam::123456789012:role/copr-deploy" {
+		t.Errorf("key provider assumes %q, want the stack's role", got)
+	}
+}
+
+func TestParentZoneDelegation(t *testing.T) {
+	t.Setenv(pulumi.EnvConfig, `{
+		"aws:region": "eu-west-1",
+		"aws:profile": "copr",
+		"aws:sharedConfigFiles": "[\"/etc/copr/aws-config\"]",
+		"aws:allowedAccountIds": "[\"123456789012\"]",
+		"aws:assumeRole": "{\"roleArn\": \"arn:aws:iam::123456789012:role/copr-deploy\"}"
+	}`)
+	args := testArgs()
+	args.PublicZone = PublicZoneArgs{
+		Mode:              PublicZoneCreate,
+		DelegateToParent:  true,
+		ParentZoneRoleArn: "arn:aws:iam::210987654321:role/zone-delegation",
+	}
+	_, m, err := newTestVpc(t, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	providers := m.inputs("pulumi:providers:aws")
+	if len(providers) != 1 {
+		t.Fatalf("got %d providers, want 1", len(providers))
+	}
+	provider := providers[0]
+	// The stack's settings carry over, except for the role and the account restrictions of the stack's own account
+	if got := provider["profile"].StringValue(); got != "copr" {
+		t.Errorf("parent zone provider profile %q, want the stack's copr", got)
+	}
+	if got := provider["region"].StringValue(); got != "eu-west-1" {
+		t.Errorf("parent zone provider region %q, want the stack's eu-west-1", got)
+	}
+	if !strings.Contains(provider["sharedConfigFiles"].String(), "/etc/copr/aws-config") {
+		t.Errorf("parent zone provider shared config files %v, want the stack's", provider["sharedConfigFiles"])
+	}
+	if provider.HasValue("allowedAccountIds") {
+		t.Errorf("parent zone provider only allows accounts %v", provider["allowedAccountIds"])
+	}
+	if got := provider["assumeRole"].ObjectValue()["roleArn"].StringValue(); got != args.PublicZone.ParentZoneRoleArn {
+		t.Errorf("parent zone provider assumes %q, want %s", got, args.PublicZone.ParentZoneRoleArn)
+	}
+	if got := m.count("aws:route53/record:Record"); got != 1 {
+		t.Errorf("got %d delegation records, want 1", got)
+	}
+
+	// The parent zone's account can be reached through another region, with nothing else to change
+	args.PublicZone.ParentZoneRoleArn = ""
+	args.PublicZone.ParentZoneRegion = "us-east-2"
+	_, m, err = newTestVpc(t, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	providers = m.inputs("pulumi:providers:aws")
+	if len(providers) != 1 || providers[0]["region"].StringValue() != "us-east-2" {
+		t.Fatalf("got providers %v, want one in us-east-2", providers)
+	}
+	if got := providers[0]["assumeRole"].ObjectValue()["roleArn"].StringValue(); got != "arn:aws:iam::123456789012:role/copr-deploy" {
+		t.Errorf("parent zone provider assumes %q, want the stack's role", got)
+	}
+}
+
+func TestIpamAllocation(t *testing.T) {
+	args := testArgs()
+	args.CidrBlock = ""
+	args.Ipam = &IpamArgs{PoolID: "ipam-pool-0copr", NetmaskLength: 16}
+	args.Subnets = SubnetArgs{PrefixLength: 24}
+	args.AvailabilityZones.Max = 3
+
+	var cidrs []string
+	var mu sync.Mutex
+	m := &mocks{}
+	err := pulumi.RunErr(func(ctx *pulumi.Context) error {
+		vpc, err := NewVpc(ctx, "test-network", args)
+		if err != nil {
+			return err
+		}
+		vpc.StackOutputs()["vpcCidrBlock"].(pulumi.StringOutput).ApplyT(func(cidr string) string {
+			mu.Lock()
+			defer mu.Unlock()
+			cidrs = append(cidrs, cidr)
+			return cidr
+		})
+		return nil
+	}, pulumi.WithMocks("copr-pulumi-go-aws-vpc", "test", m))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cidrs) != 1 || cidrs[0] != "10.42.0.0/16" {
+		t.Errorf("exported VPC CIDR %v, want the allocated 10.42.0.0/16", cidrs)
+	}
+
+	// The subnets are carved from the allocated block, not from the stand-in the layout was checked on
+	allocated := netip.MustParsePrefix("10.42.0.0/16")
+	subnets := m.inputs("aws:ec2/subnet:Subnet")
+	if len(subnets) != 6 {
+		t.Fatalf("got %d subnets, want 6", len(subnets))
+	}
+	seen := map[string]bool{}
+	for _, subnet := range subnets {
+		block := subnet["cidrBlock"].StringValue()
+		prefix, err := netip.ParsePrefix(block)
+		if err != nil || prefix.Bits() != 24 || !allocated.Contains(prefix.Addr()) {
+			t.Errorf("subnet CIDR %q is not a /24 of the allocated %s", block, allocated)
+		}
+		if seen[block] {
+			t.Errorf("subnet CIDR %s is used twice", block)
+		}
+		seen[block] = true
+	}
+
+	args.Subnets = SubnetArgs{PublicCidrs: []string{"10.42.0.0/24"}}
+	if _, _, err := newTestVpc(t, args); err == nil || !strings.Contains(err.Error(), "carved") {
+		t.Fatalf("NewVpc() error = %v, want subnets that must be carved", err)
+	}
+
+	args.Subnets = SubnetArgs{PrefixLength: 17}
+	if _, _, err := newTestVpc(t, args); err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Fatalf("NewVpc() error = %v, want a subnet prefix that is too large", err)
+	}
+}
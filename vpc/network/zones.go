@@ -0,0 +1,170 @@
+package network
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/route53"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// Values of PublicZoneArgs.Mode
+const (
+	// PublicZoneLookup uses a public zone for PublicDomainName that already exists in the account
+	PublicZoneLookup = "lookup"
+	// PublicZoneCreate creates a public zone for PublicDomainName, owned by this stack
+	PublicZoneCreate = "create"
+)
+
+// createHostedZones sets up the public hosted zone for args.PublicDomainName, signing it if asked to, and creates the
+// private hosted zone for args.PrivateDomainName, attached to the VPC.
+func createHostedZones(
+	ctx *pulumi.Context,
+	v *Vpc,
+	args *VpcArgs,
+	vpcID pulumi.StringInput,
+	opts ...pulumi.ResourceOption,
+) error {
+	publicZoneID, err := publicHostedZoneID(ctx, v, args, opts...)
+	if err != nil {
+		return err
+	}
+	v.PublicHostedZoneID = publicZoneID
+
+	if args.PublicZone.EnableDnssec {
+		if err = enableDnssec(ctx, v, args, publicZoneID, opts...); err != nil {
+			return err
+		}
+	}
+
+	privateHostedZone, err := route53.NewZone(ctx, args.ResourcePrefix+"private-hosted-zone", &route53.ZoneArgs{
+		Name: pulumi.String(args.PrivateDomainName + "."),
+		Vpcs: route53.ZoneVpcArray{
+			&route53.ZoneVpcArgs{
+				VpcId: vpcID,
+			},
+		},
+	}, opts...)
+	if err != nil {
+		return err
+	}
+	v.PrivateHostedZoneID = privateHostedZone.ID().ToStringOutput()
+	return nil
+}
+
+// publicHostedZoneID returns the ID of the public hosted zone for the public domain. Depending on the zone mode it
+// is either looked up or created; a created zone can also be delegated to from its parent zone (see
+// delegatePublicZone).
+func publicHostedZoneID(ctx *pulumi.Context, v *Vpc, args *VpcArgs, opts ...pulumi.ResourceOption) (pulumi.StringOutput, error) {
+	resPrefix := args.ResourcePrefix
+	publicDomain := args.PublicDomainName
+
+	mode := args.PublicZone.Mode
+	switch mode {
+	case "", PublicZoneLookup:
+		publicHostedZone, err := route53.LookupZone(ctx, &route53.LookupZoneArgs{
+			Name: pulumi.StringRef(publicDomain + "."),
+		})
+		if err != nil {
+			return pulumi.StringOutput{}, err
+		}
+		return pulumi.String(publicHostedZone.ZoneId).ToStringOutput(), nil
+
+	case PublicZoneCreate:
+		zone, err := route53.NewZone(ctx, resPrefix+"public-hosted-zone", &route53.ZoneArgs{
+			Name:         pulumi.String(publicDomain + "."),
+			Comment:      pulumi.String("Public zone of " + resPrefix + "vpc"),
+			ForceDestroy: pulumi.Bool(args.Debug),
+		}, opts...)
+		if err != nil {
+			return pulumi.StringOutput{}, err
+		}
+		v.PublicHostedZoneNameServers = zone.NameServers
+
+		if args.PublicZone.DelegateToParent {
+			err = delegatePublicZone(ctx, args, zone, opts...)
+			if err != nil {
+				return pulumi.StringOutput{}, err
+			}
+		}
+		return zone.ZoneId, nil
+	}
+	return pulumi.StringOutput{}, fmt.Errorf("unknown public zone mode %q, expected %s or %s",
+		mode, PublicZoneLookup, PublicZoneCreate)
+}
+
+// delegatePublicZone writes the NS records for a newly created public zone into its parent zone. The parent zone may
+// live in another account, reached through ParentZoneRoleArn, ParentZoneProfile and ParentZoneRegion; it is found by
+// ParentZoneID, or else by ParentDomainName, which defaults to the public domain without its first label.
+func delegatePublicZone(ctx *pulumi.Context, args *VpcArgs, zone *route53.Zone, opts ...pulumi.ResourceOption) error {
+	resPrefix := args.ResourcePrefix
+	publicDomain := args.PublicDomainName
+	var invokeOpts []pulumi.InvokeOption
+
+	recordOpts := opts
+	roleArn := args.PublicZone.ParentZoneRoleArn
+	profile := args.PublicZone.ParentZoneProfile
+	region := args.PublicZone.ParentZoneRegion
+	if roleArn != "" || profile != "" || region != "" {
+		// The stack's own provider settings, with the way into the parent zone's account swapped in. The stack's
+		// account restrictions would only lock the provider out of that account.
+		providerArgs, err := stackProviderArgs(ctx)
+		if err != nil {
+			return err
+		}
+		providerArgs.AllowedAccountIds = nil
+		providerArgs.ForbiddenAccountIds = nil
+		if region != "" {
+			providerArgs.Region = pulumi.String(region)
+		}
+		if roleArn != "" {
+			providerArgs.AssumeRole = &aws.ProviderAssumeRoleArgs{
+				RoleArn:     pulumi.String(roleArn),
+				SessionName: pulumi.String(resPrefix + "zone-delegation"),
+			}
+		}
+		if profile != "" {
+			providerArgs.Profile = pulumi.String(profile)
+			// The profile already leads into the parent account, the stack's role belongs to another one
+			if roleArn == "" {
+				providerArgs.AssumeRole = nil
+			}
+		}
+
+		provider, err := aws.NewProvider(ctx, resPrefix+"parent-zone-provider", providerArgs, opts...)
+		if err != nil {
+			return err
+		}
+		recordOpts = append(append([]pulumi.ResourceOption{}, opts...), pulumi.Provider(provider))
+		invokeOpts = append(invokeOpts, pulumi.Provider(provider))
+	}
+
+	parentZoneID := args.PublicZone.ParentZoneID
+	if parentZoneID == "" {
+		parentDomain := args.PublicZone.ParentDomainName
+		if parentDomain == "" {
+			_, parentDomain, _ = strings.Cut(publicDomain, ".")
+		}
+		if parentDomain == "" {
+			return fmt.Errorf("cannot work out the parent zone of %s, set a parent domain name or zone ID", publicDomain)
+		}
+
+		parentZone, err := route53.LookupZone(ctx, &route53.LookupZoneArgs{
+			Name: pulumi.StringRef(parentDomain + "."),
+		}, invokeOpts...)
+		if err != nil {
+			return fmt.Errorf("looking up parent zone %s: %w", parentDomain, err)
+		}
+		parentZoneID = parentZone.ZoneId
+	}
+
+	_, err := route53.NewRecord(ctx, resPrefix+"public-zone-delegation", &route53.RecordArgs{
+		ZoneId:  pulumi.String(parentZoneID),
+		Name:    pulumi.String(publicDomain),
+		Type:    pulumi.String("NS"),
+		Ttl:     pulumi.Int(3600),
+		Records: zone.NameServers,
+	}, recordOpts...)
+	return err
+}